@@ -0,0 +1,142 @@
+// Package cli implements kubectl-dynamic_authority, a command-line tool to
+// inspect and operate a dynamic authority. It can be used standalone, or as
+// the kubectl plugin "kubectl dynamic-authority" when installed in the PATH.
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+// NewCommand returns the root command of kubectl-dynamic_authority.
+func NewCommand() *cobra.Command {
+	return newCommand(&options{clock: clock.RealClock{}})
+}
+
+func newCommand(o *options) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:           "kubectl-dynamic_authority",
+		Short:         "Inspect and operate a dynamic authority",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+	o.bindFlags(cmd.PersistentFlags())
+	cmd.AddCommand(
+		newShowCommand(o),
+		newInjectablesCommand(o),
+		newRenewCommand(o),
+		newVerifyCommand(o),
+		newRenderCommand(o),
+	)
+	return cmd
+}
+
+// options are the options shared by all commands.
+type options struct {
+	loadingRules *clientcmd.ClientConfigLoadingRules
+	overrides    clientcmd.ConfigOverrides
+	caSecret     string
+	clock        clock.PassiveClock
+
+	// If set, used instead of a client built from the kubeconfig, e.g. by
+	// tests.
+	client    client.Client
+	namespace string
+}
+
+func (o *options) bindFlags(fs *pflag.FlagSet) {
+	o.loadingRules = clientcmd.NewDefaultClientConfigLoadingRules()
+	fs.StringVar(&o.loadingRules.ExplicitPath, clientcmd.RecommendedConfigPathFlag, "", "Path to the kubeconfig file to use.")
+	clientcmd.BindOverrideFlags(&o.overrides, fs, clientcmd.RecommendedConfigOverrideFlags(""))
+	fs.StringVar(&o.caSecret, "ca-secret", "", "The name of the CA Secret of the dynamic authority, in the namespace.")
+}
+
+// clientAndNamespace returns a client of the cluster, and the namespace of
+// the dynamic authority.
+func (o *options) clientAndNamespace() (client.Client, string, error) {
+	if o.client != nil {
+		return o.client, o.namespace, nil
+	}
+
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(o.loadingRules, &o.overrides)
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+	config, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	c, err := client.New(config, client.Options{Scheme: clientgoscheme.Scheme})
+	if err != nil {
+		return nil, "", err
+	}
+	o.client, o.namespace = c, namespace
+	return c, namespace, nil
+}
+
+// caSecretRef returns the namespaced name of the CA Secret.
+func (o *options) caSecretRef() (types.NamespacedName, error) {
+	if o.caSecret == "" {
+		return types.NamespacedName{}, errors.New("the name of the CA Secret must be set using --ca-secret")
+	}
+	_, namespace, err := o.clientAndNamespace()
+	if err != nil {
+		return types.NamespacedName{}, err
+	}
+	return types.NamespacedName{Namespace: namespace, Name: o.caSecret}, nil
+}
+
+// getCASecret returns the CA Secret.
+func (o *options) getCASecret(ctx context.Context) (*corev1.Secret, error) {
+	ref, err := o.caSecretRef()
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{}
+	if err := o.client.Get(ctx, ref, secret); err != nil {
+		return nil, fmt.Errorf("failed getting CA Secret %s: %w", ref, err)
+	}
+	return secret, nil
+}
+
+// getCABundle returns the certificates of the CA bundle in the CA Secret,
+// and its PEM encoding.
+func (o *options) getCABundle(ctx context.Context) ([]*x509.Certificate, []byte, error) {
+	secret, err := o.getCASecret(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	caBundle := secret.Data[authority.TLSCABundleKey]
+	if len(caBundle) == 0 {
+		return nil, nil, fmt.Errorf("CA Secret %s/%s has no CA bundle", secret.Namespace, secret.Name)
+	}
+	certs, err := pki.DecodeX509CertificateSetBytes(caBundle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid CA bundle in CA Secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return certs, caBundle, nil
+}
+
+// fingerprint returns the hex encoded SHA-256 fingerprint of cert, like
+// authority.ServingCertificateFingerprintAnnotation.
+func fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
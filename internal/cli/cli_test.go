@@ -0,0 +1,211 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/tls"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/yaml"
+
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+	"github.com/erikgb/dynamic-authority/pkg/authority/authoritytest"
+)
+
+var _ = Describe("kubectl-dynamic_authority", func() {
+	var (
+		a        *authoritytest.Authority
+		caSecret *corev1.Secret
+		c        client.Client
+		clock    *clocktesting.FakePassiveClock
+		run      func(args ...string) (string, error)
+	)
+
+	BeforeEach(func() {
+		var err error
+		a, err = authoritytest.New(authority.Options{Namespace: "cert-manager", CASecret: "ca-cert"})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(a.Rotate()).To(Succeed())
+		caSecret, err = a.CASecret()
+		Expect(err).ToNot(HaveOccurred())
+		c = fake.NewClientBuilder().WithObjects(caSecret).Build()
+		clock = clocktesting.NewFakePassiveClock(time.Now())
+
+		run = func(args ...string) (string, error) {
+			cmd := newCommand(&options{client: c, namespace: caSecret.Namespace, clock: clock})
+			out := &bytes.Buffer{}
+			cmd.SetOut(out)
+			cmd.SetErr(out)
+			cmd.SetArgs(append(args, "--ca-secret", caSecret.Name))
+			err := cmd.Execute()
+			return out.String(), err
+		}
+	})
+
+	It("should require the CA Secret", func() {
+		cmd := newCommand(&options{client: c, namespace: caSecret.Namespace, clock: clock})
+		cmd.SetArgs([]string{"show"})
+		Expect(cmd.Execute()).To(MatchError(ContainSubstring("--ca-secret")))
+	})
+
+	It("should show the CA and the CA bundle", func() {
+		out, err := run("show")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(ContainSubstring("CA Secret:  cert-manager/ca-cert"))
+		caFingerprint := fingerprint(a.CACertificate())
+		Expect(out).To(MatchRegexp(`(?m)^ca\s.*` + caFingerprint + `.*expires in`))
+		Expect(out).To(MatchRegexp(`(?m)^bundle \(current\)\s.*` + caFingerprint))
+		Expect(out).To(MatchRegexp(`(?m)^bundle\s`), "the previous CA")
+	})
+
+	It("should list injectables and whether their CA bundle is up to date", func() {
+		labels := map[string]string{
+			authority.WantInjectFromSecretNamespaceLabel: caSecret.Namespace,
+			authority.WantInjectFromSecretNameLabel:      caSecret.Name,
+		}
+		caBundle := caSecret.Data[authority.TLSCABundleKey]
+
+		webhook := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+		webhook.Name = "webhook"
+		webhook.Labels = labels
+		webhook.Webhooks = []admissionregistrationv1.ValidatingWebhook{
+			{Name: "a.example.com", ClientConfig: admissionregistrationv1.WebhookClientConfig{CABundle: caBundle}},
+			{Name: "b.example.com", ClientConfig: admissionregistrationv1.WebhookClientConfig{CABundle: []byte("stale")}},
+		}
+		injected := &corev1.ConfigMap{}
+		injected.Namespace = "default"
+		injected.Name = "injected"
+		injected.Labels = labels
+		pending := &corev1.ConfigMap{}
+		pending.Namespace = "default"
+		pending.Name = "pending"
+		pending.Labels = labels
+		unrelated := &corev1.ConfigMap{}
+		unrelated.Namespace = "default"
+		unrelated.Name = "unrelated"
+		unrelated.Annotations = map[string]string{authority.InjectCAFromSecretAnnotation: "cert-manager/ca-cert"}
+		Expect(c.Create(ctx, webhook)).To(Succeed())
+		Expect(c.Create(ctx, injected)).To(Succeed())
+		Expect(c.Create(ctx, pending)).To(Succeed())
+		Expect(c.Create(ctx, unrelated)).To(Succeed())
+		injected.Data = map[string]string{"ca.crt": string(caBundle)}
+		Expect(c.Update(ctx, injected)).To(Succeed())
+
+		out, err := run("injectables", "--configmap-key", "ca.crt")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(MatchRegexp(`ValidatingWebhookConfiguration\s+webhook\s+a.example.com\s+up to date`))
+		Expect(out).To(MatchRegexp(`ValidatingWebhookConfiguration\s+webhook\s+b.example.com\s+stale`))
+		Expect(out).To(MatchRegexp(`ConfigMap\s+default\s+injected\s+ca.crt\s+up to date`))
+		Expect(out).To(MatchRegexp(`ConfigMap\s+default\s+pending\s+ca.crt\s+missing`))
+		Expect(out).ToNot(ContainSubstring("unrelated"))
+
+		out, err = run("injectables", "--configmap-key", "ca.crt", "--cainjector-compatibility")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(MatchRegexp(`ConfigMap\s+default\s+unrelated\s+ca.crt\s+missing`))
+	})
+
+	It("should request renewal of the CA", func() {
+		out, err := run("renew")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(out).To(Equal("Requested renewal of CA Secret cert-manager/ca-cert\n"))
+
+		secret := &corev1.Secret{}
+		Expect(c.Get(ctx, types.NamespacedName{Namespace: caSecret.Namespace, Name: caSecret.Name}, secret)).To(Succeed())
+		Expect(secret.Annotations).To(HaveKeyWithValue(authority.RenewCertificateSecretAnnotation, clock.Now().UTC().Format(time.RFC3339Nano)))
+	})
+
+	It("should render a CA Secret and inject its CA bundle into manifests", func() {
+		cmd := newCommand(&options{clock: clock})
+		out := &bytes.Buffer{}
+		cmd.SetOut(out)
+		errOut := &bytes.Buffer{}
+		cmd.SetErr(errOut)
+		cmd.SetIn(strings.NewReader(`
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: webhook
+webhooks:
+- name: foo.example.com
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: webhook
+`))
+		cmd.SetArgs([]string{"render", "-n", "cert-manager", "--ca-secret", "ca-cert", "-f", "-"})
+		Expect(cmd.Execute()).To(Succeed())
+		Expect(errOut.String()).To(ContainSubstring("the output contains the private key of the CA"))
+
+		docs := strings.Split(out.String(), "---\n")[1:]
+		Expect(docs).To(HaveLen(3))
+		secret := &corev1.Secret{}
+		Expect(yaml.Unmarshal([]byte(docs[0]), secret)).To(Succeed())
+		Expect(secret.Namespace).To(Equal("cert-manager"))
+		Expect(secret.Name).To(Equal("ca-cert"))
+		Expect(secret).To(authoritytest.BeCASecret())
+		webhook := &admissionregistrationv1.ValidatingWebhookConfiguration{}
+		Expect(yaml.Unmarshal([]byte(docs[1]), webhook)).To(Succeed())
+		Expect(webhook.Webhooks).To(HaveLen(1))
+		Expect(webhook.Webhooks[0].ClientConfig.CABundle).To(Equal(secret.Data[authority.TLSCABundleKey]))
+		Expect(docs[2]).To(ContainSubstring("kind: Service"))
+	})
+
+	It("should render offline only with the namespace", func() {
+		cmd := newCommand(&options{clock: clock})
+		cmd.SetArgs([]string{"render", "--ca-secret", "ca-cert"})
+		Expect(cmd.Execute()).To(MatchError(ContainSubstring("--namespace")))
+	})
+
+	Context("verify", func() {
+		serve := func(issuer *authoritytest.Authority) string {
+			holder, err := issuer.CertificateHolder("foo.example.com")
+			Expect(err).ToNot(HaveOccurred())
+			listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{GetCertificate: holder.GetCertificate})
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(listener.Close)
+			go func() {
+				for {
+					conn, err := listener.Accept()
+					if err != nil {
+						return
+					}
+					_ = conn.(*tls.Conn).Handshake()
+					_ = conn.Close()
+				}
+			}()
+			return listener.Addr().String()
+		}
+
+		It("should verify a certificate issued by the authority", func() {
+			address := serve(a)
+			out, err := run("verify", address, "--server-name", "foo.example.com")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(out).To(ContainSubstring("foo.example.com"))
+			Expect(out).To(ContainSubstring("is trusted by the CA bundle"))
+		})
+
+		It("should refuse a certificate for another server name", func() {
+			address := serve(a)
+			_, err := run("verify", address, "--server-name", "bar.example.com")
+			Expect(err).To(MatchError(ContainSubstring("not trusted by the CA bundle")))
+		})
+
+		It("should refuse a certificate issued by another authority", func() {
+			other, err := authoritytest.New(authority.Options{})
+			Expect(err).ToNot(HaveOccurred())
+			address := serve(other)
+			out, err := run("verify", address, "--server-name", "foo.example.com")
+			Expect(err).To(MatchError(ContainSubstring("certificate signed by unknown authority")))
+			Expect(out).ToNot(ContainSubstring("is trusted"))
+		})
+	})
+})
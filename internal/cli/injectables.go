@@ -0,0 +1,193 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+// injectableKind is a kind of injectable, and how to read the CA bundles
+// injected into it.
+type injectableKind struct {
+	gvk schema.GroupVersionKind
+
+	// caBundles returns the CA bundles injected into obj, by location.
+	caBundles func(obj *unstructured.Unstructured) (map[string][]byte, error)
+}
+
+// injectableKinds returns the kinds of injectables supported by the dynamic
+// authority. ConfigMaps are read from configMapKey.
+func injectableKinds(configMapKey string) []injectableKind {
+	return []injectableKind{
+		{
+			gvk: (&authority.ValidatingWebhookCaBundleInject{}).GroupVersionKind(),
+			caBundles: func(obj *unstructured.Unstructured) (map[string][]byte, error) {
+				webhooks, _, err := unstructured.NestedSlice(obj.Object, "webhooks")
+				if err != nil {
+					return nil, err
+				}
+				caBundles := map[string][]byte{}
+				for _, w := range webhooks {
+					webhook, ok := w.(map[string]any)
+					if !ok {
+						return nil, fmt.Errorf("invalid webhook %v", w)
+					}
+					name, _, err := unstructured.NestedString(webhook, "name")
+					if err != nil {
+						return nil, err
+					}
+					encoded, _, err := unstructured.NestedString(webhook, "clientConfig", "caBundle")
+					if err != nil {
+						return nil, err
+					}
+					if caBundles[name], err = base64.StdEncoding.DecodeString(encoded); err != nil {
+						return nil, fmt.Errorf("invalid caBundle of webhook %s: %w", name, err)
+					}
+				}
+				return caBundles, nil
+			},
+		},
+		{
+			gvk: (&authority.ConfigMapCaBundleInject{}).GroupVersionKind(),
+			caBundles: func(obj *unstructured.Unstructured) (map[string][]byte, error) {
+				caBundle, _, err := unstructured.NestedString(obj.Object, "data", configMapKey)
+				if err != nil {
+					return nil, err
+				}
+				return map[string][]byte{configMapKey: []byte(caBundle)}, nil
+			},
+		},
+	}
+}
+
+// injectableStatus is the status of the CA bundle injected into a location
+// of an injectable.
+type injectableStatus struct {
+	kind     string
+	object   types.NamespacedName
+	location string
+	status   string
+}
+
+func newInjectablesCommand(o *options) *cobra.Command {
+	var configMapKey string
+	var caInjectorCompatibility bool
+	cmd := &cobra.Command{
+		Use:   "injectables",
+		Short: "List the injectables of the CA Secret, and whether their CA bundle is up to date",
+		Long: "List the resources labelled for injection from the CA Secret, and whether the CA bundle " +
+			"injected into them matches the current CA bundle of the CA Secret.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ref, err := o.caSecretRef()
+			if err != nil {
+				return err
+			}
+			_, caBundle, err := o.getCABundle(cmd.Context())
+			if err != nil {
+				return err
+			}
+			statuses, err := listInjectables(cmd.Context(), o.client, ref, caBundle, injectableKinds(configMapKey), caInjectorCompatibility)
+			if err != nil {
+				return err
+			}
+			return writeInjectables(cmd.OutOrStdout(), statuses)
+		},
+	}
+	cmd.Flags().StringVar(&configMapKey, "configmap-key", authority.TLSCABundleKey, "The data key of the CA bundle in ConfigMaps.")
+	cmd.Flags().BoolVar(&caInjectorCompatibility, "cainjector-compatibility", false,
+		"Also list resources annotated with "+authority.InjectCAFromSecretAnnotation+".")
+	return cmd
+}
+
+// listInjectables returns the status of the CA bundles injected into the
+// injectables of the CA Secret ref, compared to caBundle.
+func listInjectables(ctx context.Context, c client.Client, ref types.NamespacedName, caBundle []byte, kinds []injectableKind, caInjectorCompatibility bool) ([]injectableStatus, error) {
+	var statuses []injectableStatus
+	for _, kind := range kinds {
+		objList := &unstructured.UnstructuredList{}
+		objList.SetGroupVersionKind(kind.gvk.GroupVersion().WithKind(kind.gvk.Kind + "List"))
+		var opts []client.ListOption
+		if !caInjectorCompatibility {
+			opts = append(opts, client.MatchingLabels{
+				authority.WantInjectFromSecretNamespaceLabel: ref.Namespace,
+				authority.WantInjectFromSecretNameLabel:      ref.Name,
+			})
+		}
+		if err := c.List(ctx, objList, opts...); err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed listing %s: %w", kind.gvk.Kind, err)
+		}
+
+		for i := range objList.Items {
+			obj := &objList.Items[i]
+			if !wantsInjectionFrom(obj, ref, caInjectorCompatibility) {
+				continue
+			}
+			caBundles, err := kind.caBundles(obj)
+			if err != nil {
+				return nil, fmt.Errorf("failed reading CA bundle of %s %s: %w", kind.gvk.Kind, client.ObjectKeyFromObject(obj), err)
+			}
+			locations := make([]string, 0, len(caBundles))
+			for location := range caBundles {
+				locations = append(locations, location)
+			}
+			slices.Sort(locations)
+			for _, location := range locations {
+				injected := caBundles[location]
+				status := "up to date"
+				switch {
+				case len(injected) == 0:
+					status = "missing"
+				case !bytes.Equal(injected, caBundle):
+					status = "stale"
+				}
+				statuses = append(statuses, injectableStatus{
+					kind:     kind.gvk.Kind,
+					object:   client.ObjectKeyFromObject(obj),
+					location: location,
+					status:   status,
+				})
+			}
+		}
+	}
+	return statuses, nil
+}
+
+// wantsInjectionFrom returns true if obj wants injection from the CA Secret
+// ref, like the InjectableReconciler selects its injectables.
+func wantsInjectionFrom(obj client.Object, ref types.NamespacedName, caInjectorCompatibility bool) bool {
+	labels := obj.GetLabels()
+	if labels[authority.WantInjectFromSecretNamespaceLabel] == ref.Namespace && labels[authority.WantInjectFromSecretNameLabel] == ref.Name {
+		return true
+	}
+	return caInjectorCompatibility && obj.GetAnnotations()[authority.InjectCAFromSecretAnnotation] == ref.String()
+}
+
+func writeInjectables(w io.Writer, statuses []injectableStatus) error {
+	if len(statuses) == 0 {
+		_, err := fmt.Fprintln(w, "No injectables found.")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "KIND\tNAMESPACE\tNAME\tLOCATION\tCA BUNDLE")
+	for _, s := range statuses {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", s.kind, s.object.Namespace, s.object.Name, s.location, s.status)
+	}
+	return tw.Flush()
+}
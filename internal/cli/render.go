@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+func newRenderCommand(o *options) *cobra.Command {
+	var filenames []string
+	var caDuration time.Duration
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "Render a CA Secret, and inject its CA bundle into manifests",
+		Long: "Render a CA Secret in the layout maintained by the dynamic authority, followed by the given " +
+			"manifests with its CA bundle injected into webhook configurations, CRDs using a conversion " +
+			"webhook and APIServices. Install them together with the dynamic authority, which adopts the " +
+			"rendered CA. No cluster is contacted.\n\n" +
+			"The output contains the private key of the CA, and every run generates a new CA: create the " +
+			"CA Secret only once, e.g. using the Helm lookup function or the helm.sh/resource-policy: keep annotation.",
+		Example: "  kubectl dynamic-authority render -n cert-manager --ca-secret ca-cert -f webhooks.yaml",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			namespace := o.overrides.Context.Namespace
+			if namespace == "" {
+				return errors.New("the namespace of the CA Secret must be set using --namespace")
+			}
+			if o.caSecret == "" {
+				return errors.New("the name of the CA Secret must be set using --ca-secret")
+			}
+
+			var manifests []*unstructured.Unstructured
+			for _, filename := range filenames {
+				objs, err := readManifests(cmd.InOrStdin(), filename)
+				if err != nil {
+					return err
+				}
+				manifests = append(manifests, objs...)
+			}
+
+			secret, rendered, err := authority.Render(cmd.Context(), authority.Options{
+				Namespace:  namespace,
+				CASecret:   o.caSecret,
+				CADuration: caDuration,
+				Clock:      o.clock,
+			}, manifests)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.ErrOrStderr(), "Warning: the output contains the private key of the CA; keep it secret, and create the CA Secret only once")
+			return writeManifests(cmd.OutOrStdout(), secret, rendered)
+		},
+	}
+	cmd.Flags().StringArrayVarP(&filenames, "filename", "f", nil, "Manifests to inject the CA bundle into, or - to read them from stdin.")
+	cmd.Flags().DurationVar(&caDuration, "ca-duration", 0, "The amount of time the CA is valid for. Defaults to that of the dynamic authority.")
+	return cmd
+}
+
+// readManifests reads the YAML or JSON manifests in the given file, or in
+// stdin if filename is "-".
+func readManifests(stdin io.Reader, filename string) ([]*unstructured.Unstructured, error) {
+	r := stdin
+	if filename != "-" {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var objs []*unstructured.Unstructured
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bufio.NewReader(r), 4096)
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				return objs, nil
+			}
+			return nil, fmt.Errorf("failed reading manifests from %s: %w", filename, err)
+		}
+		// Skip empty documents
+		if len(obj.Object) == 0 {
+			continue
+		}
+		objs = append(objs, obj)
+	}
+}
+
+// writeManifests writes the CA Secret followed by the manifests to w, as a
+// YAML stream.
+func writeManifests(w io.Writer, secret *corev1.Secret, manifests []*unstructured.Unstructured) error {
+	objs := []any{secret}
+	for _, obj := range manifests {
+		objs = append(objs, obj.Object)
+	}
+	for _, obj := range objs {
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "---\n%s", data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+func newRenewCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "renew",
+		Short: "Request renewal of the CA",
+		Long: "Request renewal of the CA by setting the " + authority.RenewCertificateSecretAnnotation +
+			" annotation on the CA Secret. The dynamic authority generates a new CA, and retains the " +
+			"current one in the CA bundle.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			ref, err := o.caSecretRef()
+			if err != nil {
+				return err
+			}
+			if err := o.renew(cmd.Context()); err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "Requested renewal of CA Secret %s\n", ref)
+			return err
+		},
+	}
+}
+
+// renew requests renewal of the CA, by setting the renew annotation on the
+// CA Secret to the current time.
+func (o *options) renew(ctx context.Context) error {
+	secret, err := o.getCASecret(ctx)
+	if err != nil {
+		return err
+	}
+
+	patch := client.MergeFrom(secret.DeepCopy())
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[authority.RenewCertificateSecretAnnotation] = o.clock.Now().UTC().Format(time.RFC3339Nano)
+	if err := o.client.Patch(ctx, secret, patch); err != nil {
+		return fmt.Errorf("failed requesting renewal of CA Secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+func newShowCommand(o *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "show",
+		Short: "Show the CA and the certificates of the CA bundle",
+		Long: "Show the subject, serial number, SHA-256 fingerprint and expiry of the current CA " +
+			"and the other certificates of the CA bundle, and the certificate revocation list of the CA.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			secret, err := o.getCASecret(cmd.Context())
+			if err != nil {
+				return err
+			}
+			return show(cmd.OutOrStdout(), secret, o.clock.Now())
+		},
+	}
+}
+
+// show writes a description of the CA Secret to w.
+func show(w io.Writer, secret *corev1.Secret, now time.Time) error {
+	caCert, err := pki.DecodeX509CertificateBytes(secret.Data[corev1.TLSCertKey])
+	if err != nil {
+		return fmt.Errorf("invalid CA certificate in CA Secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+	caBundle, err := pki.DecodeX509CertificateSetBytes(secret.Data[authority.TLSCABundleKey])
+	if err != nil {
+		return fmt.Errorf("invalid CA bundle in CA Secret %s/%s: %w", secret.Namespace, secret.Name, err)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "CA Secret:\t%s/%s\n", secret.Namespace, secret.Name)
+	if crlBytes := secret.Data[authority.TLSCRLKey]; len(crlBytes) > 0 {
+		crl, err := pki.DecodeX509RevocationListBytes(crlBytes)
+		if err != nil {
+			return fmt.Errorf("invalid CRL in CA Secret %s/%s: %w", secret.Namespace, secret.Name, err)
+		}
+		fmt.Fprintf(tw, "CRL:\t%d revoked, next update %s\n", len(crl.RevokedCertificateEntries), crl.NextUpdate.Format(time.RFC3339))
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "ROLE\tSUBJECT\tSERIAL\tSHA-256 FINGERPRINT\tNOT BEFORE\tNOT AFTER\tSTATUS")
+	writeCert := func(role string, cert *x509.Certificate) {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", role, cert.Subject, cert.SerialNumber.Text(16), fingerprint(cert),
+			cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339), validity(cert, now))
+	}
+	writeCert("ca", caCert)
+	for _, cert := range caBundle {
+		if cert.Equal(caCert) {
+			writeCert("bundle (current)", cert)
+		} else {
+			writeCert("bundle", cert)
+		}
+	}
+	return tw.Flush()
+}
+
+// validity describes the validity of cert at now.
+func validity(cert *x509.Certificate, now time.Time) string {
+	switch {
+	case now.Before(cert.NotBefore):
+		return "not yet valid"
+	case now.After(cert.NotAfter):
+		return fmt.Sprintf("expired %s ago", duration.HumanDuration(now.Sub(cert.NotAfter)))
+	default:
+		return fmt.Sprintf("expires in %s", duration.HumanDuration(cert.NotAfter.Sub(now)))
+	}
+}
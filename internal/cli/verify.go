@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func newVerifyCommand(o *options) *cobra.Command {
+	var serverName string
+	var timeout time.Duration
+	cmd := &cobra.Command{
+		Use:   "verify HOST:PORT",
+		Short: "Verify the certificate chain served by an endpoint against the CA bundle",
+		Long: "Connect to a TLS endpoint, and verify the certificate chain it serves against the CA bundle " +
+			"of the CA Secret, like clients trusting the CA bundle do.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			caBundle, _, err := o.getCABundle(cmd.Context())
+			if err != nil {
+				return err
+			}
+			ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+			defer cancel()
+			return verify(ctx, cmd.OutOrStdout(), args[0], serverName, caBundle, o.clock.Now())
+		},
+	}
+	cmd.Flags().StringVar(&serverName, "server-name", "", "The server name to send and verify. Defaults to the host of the endpoint.")
+	cmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second, "The timeout of connecting to the endpoint.")
+	return cmd
+}
+
+// verify connects to address, and verifies the certificate chain served for
+// serverName against caBundle at now. It writes the served certificates to
+// w, and returns an error if verification fails.
+func verify(ctx context.Context, w io.Writer, address, serverName string, caBundle []*x509.Certificate, now time.Time) error {
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		serverName = host
+	}
+
+	dialer := &tls.Dialer{Config: &tls.Config{
+		ServerName: serverName,
+		// The chain is verified below, to report it even if it is not trusted
+		InsecureSkipVerify: true, //nolint:gosec // verified against the CA bundle
+	}}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed connecting to %s: %w", address, err)
+	}
+	defer conn.Close()
+	chain := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(chain) == 0 {
+		return fmt.Errorf("%s served no certificate", address)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "SUBJECT\tISSUER\tSUBJECT ALTERNATIVE NAMES\tSHA-256 FINGERPRINT\tSTATUS")
+	for _, cert := range chain {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", cert.Subject, cert.Issuer, strings.Join(subjectAltNames(cert), ","), fingerprint(cert), validity(cert, now))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	roots := x509.NewCertPool()
+	for _, cert := range caBundle {
+		roots.AddCert(cert)
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	if _, err := chain[0].Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		return errors.Join(fmt.Errorf("certificate served by %s is not trusted by the CA bundle", address), err)
+	}
+
+	_, err = fmt.Fprintf(w, "\nCertificate served by %s for %s is trusted by the CA bundle.\n", address, serverName)
+	return err
+}
+
+// subjectAltNames returns the subject alternative names of cert.
+func subjectAltNames(cert *x509.Certificate) []string {
+	var sans []string
+	sans = append(sans, cert.DNSNames...)
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, uri := range cert.URIs {
+		sans = append(sans, uri.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	return sans
+}
@@ -24,15 +24,33 @@ import (
 	"fmt"
 	"slices"
 	"time"
+
+	"k8s.io/utils/clock"
 )
 
 // CertPool is a set of certificates.
 type CertPool struct {
 	certificates map[[32]byte]*x509.Certificate
 
-	filterExpired bool
+	filterExpired   bool
+	gracePeriod     time.Duration
+	maxCertificates int
+	ordering        Ordering
+	clock           clock.PassiveClock
 }
 
+// Ordering is the order of the certificates returned by a CertPool.
+type Ordering int
+
+const (
+	// OrderByHash orders certificates by their SHA256 hash, which is stable
+	// regardless of the order certificates are added in.
+	OrderByHash Ordering = iota
+	// OrderNewestFirst orders certificates by descending NotBefore, with
+	// ties ordered by hash.
+	OrderNewestFirst
+)
+
 type Option func(*CertPool)
 
 func WithFilteredExpiredCerts(filterExpired bool) Option {
@@ -41,12 +59,45 @@ func WithFilteredExpiredCerts(filterExpired bool) Option {
 	}
 }
 
+// WithExpiryGracePeriod sets the amount of time expired certificates are
+// retained when filtering expired certificates, to tolerate clock skew.
+func WithExpiryGracePeriod(gracePeriod time.Duration) Option {
+	return func(cp *CertPool) {
+		cp.gracePeriod = gracePeriod
+	}
+}
+
+// WithMaxCertificates sets the maximum number of certificates retained by
+// Prune. Zero means no limit.
+func WithMaxCertificates(maxCertificates int) Option {
+	return func(cp *CertPool) {
+		cp.maxCertificates = maxCertificates
+	}
+}
+
+// WithOrdering sets the order of the certificates returned by the pool.
+// Defaults to OrderByHash.
+func WithOrdering(ordering Ordering) Option {
+	return func(cp *CertPool) {
+		cp.ordering = ordering
+	}
+}
+
+// WithClock sets the clock used to filter expired certificates. Defaults to
+// the real clock.
+func WithClock(clock clock.PassiveClock) Option {
+	return func(cp *CertPool) {
+		cp.clock = clock
+	}
+}
+
 // NewCertPool returns a new, empty CertPool.
 // It will deduplicate certificates based on their SHA256 hash.
 // Optionally, it can filter out expired certificates.
 func NewCertPool(options ...Option) *CertPool {
 	certPool := &CertPool{
 		certificates: make(map[[32]byte]*x509.Certificate),
+		clock:        clock.RealClock{},
 	}
 
 	for _, option := range options {
@@ -60,7 +111,7 @@ func (cp *CertPool) AddCert(cert *x509.Certificate) bool {
 	if cert == nil {
 		panic("adding nil Certificate to CertPool")
 	}
-	if cp.filterExpired && time.Now().After(cert.NotAfter) {
+	if cp.expired(cert) {
 		return false
 	}
 
@@ -69,6 +120,33 @@ func (cp *CertPool) AddCert(cert *x509.Certificate) bool {
 	return true
 }
 
+// Prune removes expired certificates, when filtering expired certificates,
+// and the oldest certificates by NotBefore exceeding the maximum number of
+// certificates. It returns the removed certificates.
+func (cp *CertPool) Prune() []*x509.Certificate {
+	var pruned []*x509.Certificate
+	for hash, cert := range cp.certificates {
+		if cp.expired(cert) {
+			pruned = append(pruned, cert)
+			delete(cp.certificates, hash)
+		}
+	}
+
+	if cp.maxCertificates > 0 && len(cp.certificates) > cp.maxCertificates {
+		newestFirst := cp.sorted(OrderNewestFirst)
+		for _, cert := range newestFirst[cp.maxCertificates:] {
+			pruned = append(pruned, cert)
+			delete(cp.certificates, sha256.Sum256(cert.Raw))
+		}
+	}
+
+	return pruned
+}
+
+func (cp *CertPool) expired(cert *x509.Certificate) bool {
+	return cp.filterExpired && cp.clock.Now().After(cert.NotAfter.Add(cp.gracePeriod))
+}
+
 // AddCertsFromPEM strictly validates a given input PEM bundle to confirm it contains
 // only valid CERTIFICATE PEM blocks. If successful, returns the validated PEM blocks with any
 // comments or extra data stripped.
@@ -170,14 +248,24 @@ func (cp *CertPool) PEMSplit() []string {
 	return pems
 }
 
-// Get the list of all x509 Certificates in the certificates pool
+// Get the list of all x509 Certificates in the certificates pool, in the
+// order of the pool
 func (cp *CertPool) Certificates() []*x509.Certificate {
+	return cp.sorted(cp.ordering)
+}
+
+func (cp *CertPool) sorted(ordering Ordering) []*x509.Certificate {
 	hashes := make([][32]byte, 0, len(cp.certificates))
 	for hash := range cp.certificates {
 		hashes = append(hashes, hash)
 	}
 
 	slices.SortFunc(hashes, func(i, j [32]byte) int {
+		if ordering == OrderNewestFirst {
+			if c := cp.certificates[j].NotBefore.Compare(cp.certificates[i].NotBefore); c != 0 {
+				return c
+			}
+		}
 		return bytes.Compare(i[:], j[:])
 	})
 
@@ -8,9 +8,14 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // SHA-1 is mandated by RFC 5280
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"fmt"
+
+	"github.com/erikgb/dynamic-authority/internal/pki/errors"
 )
 
 // SignCertificate returns a signed *x509.Certificate given a template
@@ -25,38 +30,22 @@ func SignCertificate(template *x509.Certificate, issuerCert *x509.Certificate, p
 		return nil, nil, fmt.Errorf("didn't get an expected Signer in call to SignCertificate")
 	}
 
-	var pubKeyAlgo x509.PublicKeyAlgorithm
-	var sigAlgoArg any
-
 	// NB: can't rely on issuerCert.Public or issuercert.PublicKeyAlgorithm being set reliably;
 	// but we know that signerKey.Public() will work!
-	switch pubKey := typedSigner.Public().(type) {
-	case *rsa.PublicKey:
-		pubKeyAlgo = x509.RSA
-
-		// Size is in bytes so multiply by 8 to get bits because they're more familiar
-		// This is technically not portable but if you're using cert-manager on a platform
-		// with bytes that don't have 8 bits, you've got bigger problems than this!
-		sigAlgoArg = pubKey.Size() * 8
-
-	case *ecdsa.PublicKey:
-		pubKeyAlgo = x509.ECDSA
-		sigAlgoArg = pubKey.Curve
-
-	case ed25519.PublicKey:
-		pubKeyAlgo = x509.Ed25519
-		sigAlgoArg = nil // ignored by signatureAlgorithmFromPublicKey
-
-	default:
-		return nil, nil, fmt.Errorf("unknown public key type on signing certificate: %T", issuerCert.PublicKey)
-	}
-
 	var err error
-	template.SignatureAlgorithm, err = signatureAlgorithmFromPublicKey(pubKeyAlgo, sigAlgoArg)
+	template.SignatureAlgorithm, err = signatureAlgorithmFromSigner(typedSigner)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	// x509.CreateCertificate only generates subject key identifiers for CAs
+	if len(template.SubjectKeyId) == 0 {
+		template.SubjectKeyId, err = subjectKeyID(publicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	derBytes, err := x509.CreateCertificate(rand.Reader, template, issuerCert, publicKey, signerKey)
 	if err != nil {
 		return nil, nil, fmt.Errorf("error creating x509 certificate: %s", err.Error())
@@ -87,6 +76,123 @@ func EncodeX509(cert *x509.Certificate) ([]byte, error) {
 	return caPem.Bytes(), nil
 }
 
+// EncodeX509RevocationList will encode a single *x509.RevocationList into PEM
+// format.
+func EncodeX509RevocationList(crl *x509.RevocationList) ([]byte, error) {
+	crlPem := bytes.NewBuffer([]byte{})
+	err := pem.Encode(crlPem, &pem.Block{Type: "X509 CRL", Bytes: crl.Raw})
+	if err != nil {
+		return nil, err
+	}
+
+	return crlPem.Bytes(), nil
+}
+
+// GenerateCSR returns a PEM encoded PKCS#10 certificate signing request for
+// the given template, signed by the private key of the requester. The
+// private key itself never leaves the requester; only the request is sent to
+// the authority.
+func GenerateCSR(template *x509.CertificateRequest, signer crypto.Signer) ([]byte, error) {
+	var err error
+	template.SignatureAlgorithm, err = signatureAlgorithmFromSigner(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	derBytes, err := x509.CreateCertificateRequest(rand.Reader, template, signer)
+	if err != nil {
+		return nil, fmt.Errorf("error creating x509 certificate request: %s", err.Error())
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: derBytes}), nil
+}
+
+// SignCSR returns a signed *x509.Certificate for a certificate signing
+// request, given a template *x509.Certificate and an issuer.
+// The subject, subject alternative names and public key are taken from the
+// request, and the validity and serial number from the template. The key
+// usages are taken from the template, or from the request if the template
+// has none. The certificate is passed to apply, e.g. to set the usages of a
+// certificate profile, before it is verified. The request is refused if its
+// signature is invalid, or if it violates the policy. The validity is
+// truncated to the maximum duration of the policy.
+// It returns a PEM encoded copy of the Certificate as well as a *x509.Certificate
+// which can be used for reading the encoded values.
+func SignCSR(csr *x509.CertificateRequest, template *x509.Certificate, policy CSRPolicy, apply func(*x509.Certificate) error, issuerCert *x509.Certificate, signerKey any) ([]byte, *x509.Certificate, error) {
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, errors.NewInvalidData("certificate request signature verification failed: %s", err.Error())
+	}
+
+	cert := *template
+	cert.Subject = csr.Subject
+	cert.DNSNames = csr.DNSNames
+	cert.IPAddresses = csr.IPAddresses
+	cert.URIs = csr.URIs
+	cert.EmailAddresses = csr.EmailAddresses
+	cert.PublicKey = csr.PublicKey
+	cert.PublicKeyAlgorithm = csr.PublicKeyAlgorithm
+	if cert.KeyUsage == 0 && len(cert.ExtKeyUsage) == 0 {
+		var err error
+		cert.KeyUsage, cert.ExtKeyUsage, err = requestedUsages(csr)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := apply(&cert); err != nil {
+		return nil, nil, err
+	}
+
+	if err := policy.verify(&cert); err != nil {
+		return nil, nil, err
+	}
+	if policy.MaxDuration > 0 && cert.NotAfter.Sub(cert.NotBefore) > policy.MaxDuration {
+		cert.NotAfter = cert.NotBefore.Add(policy.MaxDuration)
+	}
+
+	return SignCertificate(&cert, issuerCert, cert.PublicKey, signerKey)
+}
+
+// subjectKeyID returns the subject key identifier of a public key, which is
+// the SHA-1 hash of the subject public key as described in RFC 5280, section
+// 4.2.1.2.
+func subjectKeyID(publicKey crypto.PublicKey) ([]byte, error) {
+	spkiBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling public key: %s", err.Error())
+	}
+	var spki struct {
+		Algorithm        pkix.AlgorithmIdentifier
+		SubjectPublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(spkiBytes, &spki); err != nil {
+		return nil, fmt.Errorf("error unmarshalling public key: %s", err.Error())
+	}
+	id := sha1.Sum(spki.SubjectPublicKey.Bytes) //nolint:gosec // SHA-1 is mandated by RFC 5280
+	return id[:], nil
+}
+
+// signatureAlgorithmFromSigner returns an appropriate signature algorithm
+// for the public key of the signer.
+func signatureAlgorithmFromSigner(signer crypto.Signer) (x509.SignatureAlgorithm, error) {
+	switch pubKey := signer.Public().(type) {
+	case *rsa.PublicKey:
+		// Size is in bytes so multiply by 8 to get bits because they're more familiar
+		// This is technically not portable but if you're using cert-manager on a platform
+		// with bytes that don't have 8 bits, you've got bigger problems than this!
+		return signatureAlgorithmFromPublicKey(x509.RSA, pubKey.Size()*8)
+
+	case *ecdsa.PublicKey:
+		return signatureAlgorithmFromPublicKey(x509.ECDSA, pubKey.Curve)
+
+	case ed25519.PublicKey:
+		// The argument is ignored by signatureAlgorithmFromPublicKey
+		return signatureAlgorithmFromPublicKey(x509.Ed25519, nil)
+
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("unknown public key type on signing key: %T", pubKey)
+	}
+}
+
 // signatureAlgorithmFromPublicKey takes a public key type and an argument specific to that public
 // key, and returns an appropriate signature algorithm for that key.
 // If alg is x509.RSA, arg must be an integer key size in bits
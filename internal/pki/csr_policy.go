@@ -0,0 +1,239 @@
+package pki
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/bits"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/erikgb/dynamic-authority/internal/pki/errors"
+)
+
+// CSRPolicy restricts the certificates signed for certificate signing
+// requests by SignCSR. Subjects, subject alternative names and usages not
+// explicitly allowed are refused.
+type CSRPolicy struct {
+	// The subject common names allowed. Peers may identify clients by their
+	// common name, so it must not be chosen freely by the requester.
+	AllowedCommonNames []string
+
+	// The subject organizations allowed, e.g. identifying the groups of
+	// clients.
+	AllowedOrganizations []string
+
+	// The DNS names allowed. A name may contain a wildcard as the left-most
+	// label, e.g. "*.example.com", allowing any single label in its place.
+	AllowedDNSNames []string
+
+	// The networks IP addresses are allowed in.
+	AllowedIPNets []*net.IPNet
+
+	// The URIs allowed. A URI ending with "*" allows any URI with the
+	// preceding prefix, e.g. "spiffe://cluster.local/ns/default/*".
+	AllowedURIs []string
+
+	// The email addresses allowed.
+	AllowedEmailAddresses []string
+
+	// The key usages allowed.
+	AllowedKeyUsages x509.KeyUsage
+
+	// The extended key usages allowed. At least one extended key usage must
+	// be requested, as a certificate without any is valid for all usages.
+	AllowedExtKeyUsages []x509.ExtKeyUsage
+
+	// The maximum duration of signed certificates. Zero means no limit.
+	MaxDuration time.Duration
+}
+
+// verify returns an error listing the violations of the policy by the
+// certificate, if any.
+func (p CSRPolicy) verify(cert *x509.Certificate) error {
+	var violations []string
+
+	if cert.IsCA {
+		violations = append(violations, "CA certificates are not allowed")
+	}
+	if cn := cert.Subject.CommonName; cn != "" && !slices.Contains(p.AllowedCommonNames, cn) {
+		violations = append(violations, fmt.Sprintf("common name %q is not allowed", cn))
+	}
+	for _, organization := range cert.Subject.Organization {
+		if !slices.Contains(p.AllowedOrganizations, organization) {
+			violations = append(violations, fmt.Sprintf("organization %q is not allowed", organization))
+		}
+	}
+	if hasOtherSubjectAttributes(cert.Subject) {
+		violations = append(violations, "subject attributes other than the common name and organization are not allowed")
+	}
+	for _, dnsName := range cert.DNSNames {
+		if !slices.ContainsFunc(p.AllowedDNSNames, func(pattern string) bool { return matchDNSName(pattern, dnsName) }) {
+			violations = append(violations, fmt.Sprintf("DNS name %q is not allowed", dnsName))
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if !slices.ContainsFunc(p.AllowedIPNets, func(ipNet *net.IPNet) bool { return ipNet.Contains(ip) }) {
+			violations = append(violations, fmt.Sprintf("IP address %s is not allowed", ip))
+		}
+	}
+	for _, uri := range cert.URIs {
+		if !slices.ContainsFunc(p.AllowedURIs, func(pattern string) bool { return matchURI(pattern, uri.String()) }) {
+			violations = append(violations, fmt.Sprintf("URI %q is not allowed", uri))
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if !slices.Contains(p.AllowedEmailAddresses, email) {
+			violations = append(violations, fmt.Sprintf("email address %q is not allowed", email))
+		}
+	}
+	if len(cert.DNSNames) == 0 && len(cert.IPAddresses) == 0 && len(cert.URIs) == 0 && len(cert.EmailAddresses) == 0 {
+		violations = append(violations, "at least one subject alternative name is required")
+	}
+
+	if disallowed := cert.KeyUsage &^ p.AllowedKeyUsages; disallowed != 0 {
+		violations = append(violations, fmt.Sprintf("key usages %#x are not allowed", int(disallowed)))
+	}
+	if len(cert.ExtKeyUsage) == 0 {
+		violations = append(violations, "at least one extended key usage is required")
+	}
+	for _, usage := range cert.ExtKeyUsage {
+		if !slices.Contains(p.AllowedExtKeyUsages, usage) {
+			violations = append(violations, fmt.Sprintf("extended key usage %d is not allowed", usage))
+		}
+	}
+	if len(cert.UnknownExtKeyUsage) > 0 {
+		violations = append(violations, "unknown extended key usages are not allowed")
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("%w: %s", errors.ErrPolicyViolation, strings.Join(violations, "; "))
+	}
+	return nil
+}
+
+// hasOtherSubjectAttributes returns true if the subject has attributes other
+// than the common name and organization.
+func hasOtherSubjectAttributes(subject pkix.Name) bool {
+	return len(subject.Country) > 0 || len(subject.OrganizationalUnit) > 0 || len(subject.Locality) > 0 ||
+		len(subject.Province) > 0 || len(subject.StreetAddress) > 0 || len(subject.PostalCode) > 0 ||
+		subject.SerialNumber != "" || len(subject.ExtraNames) > 0
+}
+
+// matchDNSName returns true if the DNS name matches the pattern, which may
+// contain a wildcard as the left-most label.
+func matchDNSName(pattern, dnsName string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		label, rest, found := strings.Cut(dnsName, ".")
+		return found && label != "" && label != "*" && strings.EqualFold(rest, suffix)
+	}
+	return strings.EqualFold(pattern, dnsName)
+}
+
+// matchURI returns true if the URI matches the pattern, which may end with
+// a "*" to match any suffix.
+func matchURI(pattern, uri string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return strings.HasPrefix(uri, prefix)
+	}
+	return pattern == uri
+}
+
+var (
+	oidExtensionKeyUsage    = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// extKeyUsageOIDs are the OIDs of the extended key usages that may be
+// requested.
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageServerAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	x509.ExtKeyUsageClientAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	x509.ExtKeyUsageCodeSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	x509.ExtKeyUsageEmailProtection: {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	x509.ExtKeyUsageTimeStamping:    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	x509.ExtKeyUsageOCSPSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+}
+
+// UsageExtensions returns the extensions requesting the key usages and
+// extended key usages in a certificate signing request, see GenerateCSR.
+func UsageExtensions(keyUsage x509.KeyUsage, extKeyUsage []x509.ExtKeyUsage) ([]pkix.Extension, error) {
+	var extensions []pkix.Extension
+	if keyUsage != 0 {
+		// The DER encoding of a named bit list has no trailing zero bits
+		bitLength := bits.Len(uint(keyUsage))
+		usageBits := asn1.BitString{Bytes: make([]byte, (bitLength+7)/8), BitLength: bitLength}
+		for i := 0; i < bitLength; i++ {
+			if keyUsage&(1<<uint(i)) != 0 {
+				usageBits.Bytes[i/8] |= 0x80 >> uint(i%8)
+			}
+		}
+		value, err := asn1.Marshal(usageBits)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionKeyUsage, Critical: true, Value: value})
+	}
+	if len(extKeyUsage) > 0 {
+		oids := make([]asn1.ObjectIdentifier, 0, len(extKeyUsage))
+		for _, usage := range extKeyUsage {
+			oid, ok := extKeyUsageOIDs[usage]
+			if !ok {
+				return nil, fmt.Errorf("unsupported extended key usage %d", usage)
+			}
+			oids = append(oids, oid)
+		}
+		value, err := asn1.Marshal(oids)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionExtKeyUsage, Value: value})
+	}
+	return extensions, nil
+}
+
+// requestedUsages returns the key usages and extended key usages requested
+// by extensions of the certificate signing request.
+func requestedUsages(csr *x509.CertificateRequest) (x509.KeyUsage, []x509.ExtKeyUsage, error) {
+	var keyUsage x509.KeyUsage
+	var extKeyUsage []x509.ExtKeyUsage
+	for _, ext := range csr.Extensions {
+		switch {
+		case ext.Id.Equal(oidExtensionKeyUsage):
+			var bits asn1.BitString
+			if _, err := asn1.Unmarshal(ext.Value, &bits); err != nil {
+				return 0, nil, errors.NewInvalidData("error parsing requested key usage: %s", err.Error())
+			}
+			for i := 0; i < 9; i++ {
+				if bits.At(i) != 0 {
+					keyUsage |= 1 << uint(i)
+				}
+			}
+		case ext.Id.Equal(oidExtensionExtKeyUsage):
+			var oids []asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(ext.Value, &oids); err != nil {
+				return 0, nil, errors.NewInvalidData("error parsing requested extended key usage: %s", err.Error())
+			}
+			for _, oid := range oids {
+				usage, ok := extKeyUsageFromOID(oid)
+				if !ok {
+					return 0, nil, fmt.Errorf("%w: extended key usage %s is not allowed", errors.ErrPolicyViolation, oid)
+				}
+				extKeyUsage = append(extKeyUsage, usage)
+			}
+		}
+	}
+	return keyUsage, extKeyUsage, nil
+}
+
+func extKeyUsageFromOID(oid asn1.ObjectIdentifier) (x509.ExtKeyUsage, bool) {
+	for usage, usageOID := range extKeyUsageOIDs {
+		if oid.Equal(usageOID) {
+			return usage, true
+		}
+	}
+	return 0, false
+}
@@ -1,9 +1,41 @@
 package errors
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
-type invalidDataError struct{ error }
+var (
+	// ErrInvalidData is matched by errors.Is for all InvalidDataErrors.
+	ErrInvalidData = errors.New("invalid data")
+	// ErrPolicyViolation is returned when a certificate signing request is
+	// refused by the policy of the signer.
+	ErrPolicyViolation = errors.New("certificate request violates policy")
+	// ErrLintFailed is returned when a certificate has lint findings of
+	// error severity, and must not be published.
+	ErrLintFailed = errors.New("certificate failed linting")
+)
+
+// InvalidDataError is returned when certificate, key or CRL data can't be
+// decoded or is otherwise invalid.
+type InvalidDataError struct{ error }
 
 func NewInvalidData(str string, obj ...interface{}) error {
-	return &invalidDataError{error: fmt.Errorf(str, obj...)}
+	return &InvalidDataError{error: fmt.Errorf(str, obj...)}
+}
+
+// Is reports whether target is ErrInvalidData.
+func (e *InvalidDataError) Is(target error) bool {
+	return target == ErrInvalidData
+}
+
+// Unwrap returns the underlying error.
+func (e *InvalidDataError) Unwrap() error {
+	return e.error
+}
+
+// IsInvalidData returns true if err, or any error it wraps, is an
+// InvalidDataError.
+func IsInvalidData(err error) bool {
+	return errors.Is(err, ErrInvalidData)
 }
@@ -13,6 +13,14 @@ import (
 )
 
 const (
+	// MinRSAKeySize is the minimum RSA keysize allowed to be generated by the
+	// generator functions in this package.
+	MinRSAKeySize = 2048
+
+	// MaxRSAKeySize is the maximum RSA keysize allowed to be generated by the
+	// generator functions in this package.
+	MaxRSAKeySize = 8192
+
 	// ECCurve256 represents a secp256r1 / prime256v1 / NIST P-256 ECDSA key.
 	ECCurve256 = 256
 	// ECCurve384 represents a secp384r1 / NIST P-384 ECDSA key.
@@ -21,6 +29,36 @@ const (
 	ECCurve521 = 521
 )
 
+// GeneratePrivateKey will generate a private key of the given public key
+// algorithm, using a default key size: 2048 bit RSA, P-384 ECDSA or Ed25519.
+func GeneratePrivateKey(alg x509.PublicKeyAlgorithm) (crypto.Signer, error) {
+	switch alg {
+	case x509.RSA:
+		return GenerateRSAPrivateKey(MinRSAKeySize)
+	case x509.ECDSA, x509.UnknownPublicKeyAlgorithm:
+		return GenerateECPrivateKey(ECCurve384)
+	case x509.Ed25519:
+		return GenerateEd25519PrivateKey()
+	default:
+		return nil, fmt.Errorf("unsupported public key algorithm: %s", alg)
+	}
+}
+
+// GenerateRSAPrivateKey will generate a RSA private key of the given size.
+// It places restrictions on the minimum and maximum RSA keysize.
+func GenerateRSAPrivateKey(keySize int) (*rsa.PrivateKey, error) {
+	// Do not allow keySize < 2048
+	// https://en.wikipedia.org/wiki/Key_size#cite_note-twirl-14
+	if keySize < MinRSAKeySize {
+		return nil, fmt.Errorf("weak rsa key size specified: %d. minimum key size: %d", keySize, MinRSAKeySize)
+	}
+	if keySize > MaxRSAKeySize {
+		return nil, fmt.Errorf("rsa key size specified too big: %d. maximum key size: %d", keySize, MaxRSAKeySize)
+	}
+
+	return rsa.GenerateKey(rand.Reader, keySize)
+}
+
 // GenerateECPrivateKey will generate an ECDSA private key of the given size.
 // It can be used to generate 256, 384 and 521 sized keys.
 func GenerateECPrivateKey(keySize int) (*ecdsa.PrivateKey, error) {
@@ -40,6 +78,13 @@ func GenerateECPrivateKey(keySize int) (*ecdsa.PrivateKey, error) {
 	return ecdsa.GenerateKey(ecCurve, rand.Reader)
 }
 
+// GenerateEd25519PrivateKey will generate an Ed25519 private key
+func GenerateEd25519PrivateKey() (ed25519.PrivateKey, error) {
+	_, prvkey, err := ed25519.GenerateKey(rand.Reader)
+
+	return prvkey, err
+}
+
 // EncodePrivateKey will encode a given crypto.PrivateKey by first inspecting
 // the type of key encoding and then inspecting the type of key provided.
 // It only supports encoding RSA or ECDSA keys.
@@ -0,0 +1,233 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/erikgb/dynamic-authority/internal/pki/errors"
+)
+
+// LintRule identifies a check performed by a Linter.
+type LintRule string
+
+const (
+	// LintRuleKeyUsage checks that the key usages match the key type and
+	// whether the certificate is a CA, e.g. that ECDSA keys are not used
+	// for key encipherment.
+	LintRuleKeyUsage LintRule = "KeyUsage"
+	// LintRuleKeyIdentifier checks that the certificate has a subject key
+	// identifier, and an authority key identifier unless it is self-signed.
+	LintRuleKeyIdentifier LintRule = "KeyIdentifier"
+	// LintRuleValidity checks that the certificate is not valid outside of
+	// the validity of its issuer.
+	LintRuleValidity LintRule = "Validity"
+	// LintRuleSubjectAltName checks the syntax of the subject alternative
+	// names, and that server certificates have at least one.
+	LintRuleSubjectAltName LintRule = "SubjectAltName"
+	// LintRuleSerialNumber checks that the serial number is positive and
+	// between 8 and 20 octets long. The length only bounds the space random
+	// serial numbers are drawn from; it can't tell their entropy.
+	LintRuleSerialNumber LintRule = "SerialNumber"
+	// LintRuleWeakAlgorithm checks that neither the signature algorithm nor
+	// the key is weak.
+	LintRuleWeakAlgorithm LintRule = "WeakAlgorithm"
+)
+
+// LintSeverity is the severity of findings of a LintRule.
+type LintSeverity int
+
+const (
+	// LintSeverityError findings prevent the certificate from being
+	// published.
+	LintSeverityError LintSeverity = iota
+	// LintSeverityWarning findings are reported, but don't prevent the
+	// certificate from being published.
+	LintSeverityWarning
+	// LintSeverityIgnore findings are not reported.
+	LintSeverityIgnore
+)
+
+func (s LintSeverity) String() string {
+	switch s {
+	case LintSeverityError:
+		return "error"
+	case LintSeverityWarning:
+		return "warning"
+	case LintSeverityIgnore:
+		return "ignore"
+	default:
+		return fmt.Sprintf("LintSeverity(%d)", int(s))
+	}
+}
+
+// LintFinding is a problem found by a Linter.
+type LintFinding struct {
+	Rule     LintRule
+	Severity LintSeverity
+	Message  string
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s: %s", f.Rule, f.Message)
+}
+
+// Linter checks certificates for problems before they are published.
+type Linter struct {
+	// The severity of findings by rule. Rules not listed are errors.
+	Severities map[LintRule]LintSeverity
+}
+
+// Lint checks a certificate issued by issuer, which is the certificate itself
+// if it is self-signed. It returns the findings that are not ignored, and an
+// error matching errors.ErrLintFailed if any of them is an error.
+func (l Linter) Lint(cert, issuer *x509.Certificate) ([]LintFinding, error) {
+	var findings []LintFinding
+	report := func(rule LintRule, format string, args ...any) {
+		severity := l.Severities[rule]
+		if severity == LintSeverityIgnore {
+			return
+		}
+		findings = append(findings, LintFinding{Rule: rule, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	lintKeyUsage(cert, report)
+	lintKeyIdentifier(cert, issuer, report)
+	lintValidity(cert, issuer, report)
+	lintSubjectAltName(cert, report)
+	lintSerialNumber(cert, report)
+	lintWeakAlgorithm(cert, report)
+
+	var failed []string
+	for _, f := range findings {
+		if f.Severity == LintSeverityError {
+			failed = append(failed, f.String())
+		}
+	}
+	if len(failed) > 0 {
+		return findings, fmt.Errorf("%w: %s", errors.ErrLintFailed, strings.Join(failed, "; "))
+	}
+	return findings, nil
+}
+
+type reportFunc func(rule LintRule, format string, args ...any)
+
+func lintKeyUsage(cert *x509.Certificate, report reportFunc) {
+	// Only RSA keys can encipher keys; ECDSA and Ed25519 keys can only sign
+	if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok && cert.KeyUsage&(x509.KeyUsageKeyEncipherment|x509.KeyUsageDataEncipherment) != 0 {
+		report(LintRuleKeyUsage, "key encipherment is not supported by %s keys", cert.PublicKeyAlgorithm)
+	}
+	if _, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok && cert.KeyUsage&x509.KeyUsageKeyAgreement != 0 {
+		report(LintRuleKeyUsage, "key agreement is not supported by %s keys", cert.PublicKeyAlgorithm)
+	}
+	if cert.IsCA && cert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		report(LintRuleKeyUsage, "CA certificate without certificate signing key usage")
+	}
+	if !cert.IsCA && cert.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		report(LintRuleKeyUsage, "certificate or CRL signing key usage in a leaf certificate")
+	}
+	if cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 && !cert.IsCA {
+		report(LintRuleKeyUsage, "leaf certificate without digital signature key usage")
+	}
+}
+
+func lintKeyIdentifier(cert, issuer *x509.Certificate, report reportFunc) {
+	if len(cert.SubjectKeyId) == 0 {
+		report(LintRuleKeyIdentifier, "missing subject key identifier")
+	}
+	if bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil {
+		return
+	}
+	if len(cert.AuthorityKeyId) == 0 {
+		report(LintRuleKeyIdentifier, "missing authority key identifier")
+	} else if len(issuer.SubjectKeyId) > 0 && !bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId) {
+		report(LintRuleKeyIdentifier, "authority key identifier does not match the issuer")
+	}
+}
+
+func lintValidity(cert, issuer *x509.Certificate, report reportFunc) {
+	if !cert.NotAfter.After(cert.NotBefore) {
+		report(LintRuleValidity, "NotAfter %s is not after NotBefore %s", cert.NotAfter, cert.NotBefore)
+	}
+	if cert.NotBefore.Before(issuer.NotBefore) {
+		report(LintRuleValidity, "NotBefore %s is before the NotBefore of the issuer %s", cert.NotBefore, issuer.NotBefore)
+	}
+	if cert.NotAfter.After(issuer.NotAfter) {
+		report(LintRuleValidity, "NotAfter %s is after the NotAfter of the issuer %s", cert.NotAfter, issuer.NotAfter)
+	}
+}
+
+func lintSubjectAltName(cert *x509.Certificate, report reportFunc) {
+	for _, dnsName := range cert.DNSNames {
+		isValid := validation.IsDNS1123Subdomain
+		if strings.HasPrefix(dnsName, "*.") {
+			isValid = validation.IsWildcardDNS1123Subdomain
+		}
+		if msgs := isValid(dnsName); len(msgs) > 0 {
+			report(LintRuleSubjectAltName, "invalid DNS name %q: %s", dnsName, strings.Join(msgs, ", "))
+		}
+	}
+	for _, ip := range cert.IPAddresses {
+		if ip.IsUnspecified() {
+			report(LintRuleSubjectAltName, "unspecified IP address %s", ip)
+		}
+	}
+	for _, uri := range cert.URIs {
+		if !uri.IsAbs() || uri.Opaque == "" && uri.Host == "" {
+			report(LintRuleSubjectAltName, "URI %q is not absolute", uri)
+		}
+	}
+	for _, email := range cert.EmailAddresses {
+		if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+			report(LintRuleSubjectAltName, "invalid email address %q", email)
+		}
+	}
+
+	hasSAN := len(cert.DNSNames) > 0 || len(cert.IPAddresses) > 0 || len(cert.URIs) > 0 || len(cert.EmailAddresses) > 0
+	for _, usage := range cert.ExtKeyUsage {
+		if usage == x509.ExtKeyUsageServerAuth && !hasSAN {
+			report(LintRuleSubjectAltName, "server certificate without subject alternative names")
+		}
+	}
+}
+
+func lintSerialNumber(cert *x509.Certificate, report reportFunc) {
+	if cert.SerialNumber == nil || cert.SerialNumber.Sign() <= 0 {
+		report(LintRuleSerialNumber, "serial number is not positive")
+		return
+	}
+	// The DER encoding of a positive integer has a leading zero bit
+	switch octets := cert.SerialNumber.BitLen()/8 + 1; {
+	case octets < 8:
+		report(LintRuleSerialNumber, "serial number is shorter than 8 octets")
+	case octets > 20:
+		report(LintRuleSerialNumber, "serial number is longer than 20 octets")
+	}
+}
+
+func lintWeakAlgorithm(cert *x509.Certificate, report reportFunc) {
+	switch cert.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.DSAWithSHA256, x509.ECDSAWithSHA1:
+		report(LintRuleWeakAlgorithm, "weak signature algorithm %s", cert.SignatureAlgorithm)
+	}
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < MinRSAKeySize {
+			report(LintRuleWeakAlgorithm, "RSA key size %d is less than %d", pub.N.BitLen(), MinRSAKeySize)
+		}
+	case *ecdsa.PublicKey:
+		if pub.Curve.Params().BitSize < ECCurve256 {
+			report(LintRuleWeakAlgorithm, "ECDSA curve %s is weak", pub.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+	default:
+		report(LintRuleWeakAlgorithm, "unsupported public key type %T", pub)
+	}
+}
@@ -89,3 +89,34 @@ func DecodePrivateKeyBytes(keyBytes []byte) (crypto.Signer, error) {
 		return nil, errors.NewInvalidData("unknown private key type: %s", block.Type)
 	}
 }
+
+// DecodeX509RevocationListBytes will decode a PEM encoded x509 CRL.
+func DecodeX509RevocationListBytes(crlBytes []byte) (*x509.RevocationList, error) {
+	block, _ := pem.Decode(crlBytes)
+	if block == nil || block.Type != "X509 CRL" {
+		return nil, errors.NewInvalidData("error decoding CRL PEM block")
+	}
+
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return nil, errors.NewInvalidData("error parsing CRL: %s", err.Error())
+	}
+
+	return crl, nil
+}
+
+// DecodeX509CertificateRequestBytes will decode a PEM encoded PKCS#10
+// certificate signing request. Its signature is verified by SignCSR.
+func DecodeX509CertificateRequestBytes(csrBytes []byte) (*x509.CertificateRequest, error) {
+	block, _ := pem.Decode(csrBytes)
+	if block == nil || (block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST") {
+		return nil, errors.NewInvalidData("error decoding certificate request PEM block")
+	}
+
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, errors.NewInvalidData("error parsing certificate request: %s", err.Error())
+	}
+
+	return csr, nil
+}
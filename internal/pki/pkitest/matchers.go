@@ -0,0 +1,97 @@
+// Package pkitest provides Gomega matchers for certificates and keys.
+package pkitest
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+
+	"github.com/onsi/gomega/gcustom"
+	"github.com/onsi/gomega/types"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+// HaveKeyPair succeeds if the actual data, e.g. the data of a Secret,
+// contains a PEM encoded certificate at certKey and the matching PEM encoded
+// private key at keyKey.
+func HaveKeyPair(certKey, keyKey string) types.GomegaMatcher {
+	return gcustom.MakeMatcher(func(data map[string][]byte) (bool, error) {
+		cert, err := pki.DecodeX509CertificateBytes(data[certKey])
+		if err != nil {
+			return false, fmt.Errorf("invalid certificate at %q: %w", certKey, err)
+		}
+		pk, err := pki.DecodePrivateKeyBytes(data[keyKey])
+		if err != nil {
+			return false, fmt.Errorf("invalid private key at %q: %w", keyKey, err)
+		}
+		return pki.PublicKeysEqual(cert.PublicKey, pk.Public())
+	}).WithTemplate("Expected certificate {{.Data.CertKey}} to match private key {{.Data.KeyKey}} in\n{{.FormattedActual}}",
+		map[string]string{"CertKey": certKey, "KeyKey": keyKey})
+}
+
+// HaveCACertificate succeeds if the actual data contains a PEM encoded,
+// self-signed CA certificate at certKey.
+func HaveCACertificate(certKey string) types.GomegaMatcher {
+	return gcustom.MakeMatcher(func(data map[string][]byte) (bool, error) {
+		cert, err := pki.DecodeX509CertificateBytes(data[certKey])
+		if err != nil {
+			return false, fmt.Errorf("invalid certificate at %q: %w", certKey, err)
+		}
+		return isSignedBy(cert, cert), nil
+	}).WithTemplate("Expected {{.Data}} to be a self-signed CA certificate in\n{{.FormattedActual}}", certKey)
+}
+
+// HaveCertificateInBundle succeeds if the PEM encoded certificate at certKey
+// of the actual data is contained in the PEM encoded bundle at bundleKey.
+func HaveCertificateInBundle(certKey, bundleKey string) types.GomegaMatcher {
+	return gcustom.MakeMatcher(func(data map[string][]byte) (bool, error) {
+		cert, err := pki.DecodeX509CertificateBytes(data[certKey])
+		if err != nil {
+			return false, fmt.Errorf("invalid certificate at %q: %w", certKey, err)
+		}
+		bundle, err := pki.DecodeX509CertificateSetBytes(data[bundleKey])
+		if err != nil {
+			return false, fmt.Errorf("invalid bundle at %q: %w", bundleKey, err)
+		}
+		for _, c := range bundle {
+			if c.Equal(cert) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}).WithTemplate("Expected certificate {{.Data.CertKey}} to be in bundle {{.Data.BundleKey}} in\n{{.FormattedActual}}",
+		map[string]string{"CertKey": certKey, "BundleKey": bundleKey})
+}
+
+// BeSignedBy succeeds if the actual certificate, either an *x509.Certificate
+// or PEM encoded, is signed by the given CA certificate.
+func BeSignedBy(ca *x509.Certificate) types.GomegaMatcher {
+	return gcustom.MakeMatcher(func(actual any) (bool, error) {
+		cert, err := toCertificate(actual)
+		if err != nil {
+			return false, err
+		}
+		return isSignedBy(cert, ca), nil
+	}).WithTemplate("Expected\n{{.FormattedActual}}\nto be signed by CA {{.Data}}", ca.Subject.String())
+}
+
+func isSignedBy(cert, ca *x509.Certificate) bool {
+	return ca.IsCA && cert.CheckSignatureFrom(ca) == nil
+}
+
+func toCertificate(actual any) (*x509.Certificate, error) {
+	switch c := actual.(type) {
+	case *x509.Certificate:
+		if c == nil {
+			return nil, errors.New("certificate is nil")
+		}
+		return c, nil
+	case []byte:
+		return pki.DecodeX509CertificateBytes(c)
+	case string:
+		return pki.DecodeX509CertificateBytes([]byte(c))
+	default:
+		return nil, fmt.Errorf("expected an *x509.Certificate or PEM encoded certificate, got %T", actual)
+	}
+}
@@ -0,0 +1,123 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/sha1" //nolint:gosec // SHA-1 is mandated by the JKS format
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"unicode/utf16"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// DefaultTrustStorePassword is the password commonly used for truststores.
+const DefaultTrustStorePassword = pkcs12.DefaultPassword
+
+// EncodePKCS12TrustStore encodes the certificates as a PKCS#12 truststore,
+// usable as a Java truststore. The encoding is deterministic for the same
+// certificates and password, as the salts are derived from the certificates
+// instead of being random. This is acceptable as a truststore only contains
+// public certificates, protected by the MAC. The password is left out, so
+// the salts don't allow testing password guesses without key derivation.
+func EncodePKCS12TrustStore(certs []*x509.Certificate, password string) ([]byte, error) {
+	entries := make([]pkcs12.TrustStoreEntry, 0, len(certs))
+	for _, cert := range certs {
+		entries = append(entries, pkcs12.TrustStoreEntry{Cert: cert, FriendlyName: trustStoreAlias(cert)})
+	}
+	pfxData, err := pkcs12.Modern2023.WithRand(newDeterministicReader(certs)).EncodeTrustStoreEntries(entries, password)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding PKCS#12 truststore: %w", err)
+	}
+	return pfxData, nil
+}
+
+const (
+	jksMagic            = 0xFEEDFEED
+	jksVersion          = 2
+	jksTrustedCertEntry = 2
+	jksWhitener         = "Mighty Aphrodite"
+)
+
+// EncodeJKSTrustStore encodes the certificates as a JKS truststore. The
+// encoding is deterministic for the same certificates and password, as the
+// creation date of each entry is the NotBefore of its certificate.
+func EncodeJKSTrustStore(certs []*x509.Certificate, password string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	write := func(v any) {
+		// Writes to a bytes.Buffer don't fail
+		_ = binary.Write(buf, binary.BigEndian, v)
+	}
+	writeUTF := func(s string) {
+		write(uint16(len(s)))
+		buf.WriteString(s)
+	}
+
+	write(uint32(jksMagic))
+	write(uint32(jksVersion))
+	write(uint32(len(certs)))
+	for _, cert := range certs {
+		write(uint32(jksTrustedCertEntry))
+		writeUTF(trustStoreAlias(cert))
+		write(cert.NotBefore.UnixMilli())
+		writeUTF("X.509")
+		write(uint32(len(cert.Raw)))
+		buf.Write(cert.Raw)
+	}
+
+	// The integrity digest is keyed by the password encoded as UTF-16
+	digest := sha1.New() //nolint:gosec // SHA-1 is mandated by the JKS format
+	for _, c := range utf16.Encode([]rune(password)) {
+		digest.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	digest.Write([]byte(jksWhitener))
+	digest.Write(buf.Bytes())
+	buf.Write(digest.Sum(nil))
+
+	return buf.Bytes(), nil
+}
+
+// trustStoreAlias returns the alias of the certificate in truststores,
+// which is its lowercase SHA-256 fingerprint as aliases are case-insensitive.
+func trustStoreAlias(cert *x509.Certificate) string {
+	fingerprint := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(fingerprint[:])
+}
+
+// deterministicReader is an io.Reader returning a stream of bytes derived
+// from a seed, by hashing the seed with a counter.
+type deterministicReader struct {
+	seed    [32]byte
+	counter uint64
+	buf     []byte
+}
+
+func newDeterministicReader(certs []*x509.Certificate) io.Reader {
+	h := sha256.New()
+	for _, cert := range certs {
+		h.Write(cert.Raw)
+	}
+	r := &deterministicReader{}
+	h.Sum(r.seed[:0])
+	return r
+}
+
+func (r *deterministicReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			block := sha256.New()
+			block.Write(r.seed[:])
+			_ = binary.Write(block, binary.BigEndian, r.counter)
+			r.counter++
+			r.buf = block.Sum(nil)
+		}
+		c := copy(p[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return n, nil
+}
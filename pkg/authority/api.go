@@ -2,14 +2,23 @@ package authority
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	admissionregistrationv1ac "k8s.io/client-go/applyconfigurations/admissionregistration/v1"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/utils/clock"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -33,10 +42,19 @@ const (
 	// particular object wants injection of dynamic CAs from secret with name.
 	// Must be used in conjunction with WantInjectFromSecretNamespaceLabel.
 	WantInjectFromSecretNameLabel = "cert-manager.io/inject-dynamic-ca-from-secret-name"
+	// InjectCAFromSecretAnnotation is the annotation used by the cert-manager
+	// cainjector to specify the namespaced name, i.e. "namespace/name", of a
+	// secret to inject the CA from. It is honoured in addition to the
+	// WantInjectFromSecret*Label labels when Options.CAInjectorCompatibility
+	// is set.
+	InjectCAFromSecretAnnotation = "cert-manager.io/inject-ca-from-secret"
 
 	// TLSCABundleKey is used as a data key in Secret resources to store a CA
 	// certificate bundle.
 	TLSCABundleKey = "ca-bundle.crt"
+	// TLSCRLKey is used as a data key in the CA Secret to store the PEM
+	// encoded certificate revocation list of the CA.
+	TLSCRLKey = "ca.crl"
 
 	// RenewCertificateSecretAnnotation is an annotation that can be set to
 	// an arbitrary value on a certificate secret to trigger a renewal of the
@@ -46,6 +64,25 @@ const (
 	// certificate secret whenever a new certificate is renewed using the
 	// RenewCertificateSecretAnnotation annotation.
 	RenewHandledCertificateSecretAnnotation = "renew.cert-manager.io/lastRequestedAt"
+	// RevokeCertificatesAnnotation is an annotation that can be set on the CA
+	// Secret to a comma separated list of hex encoded serial numbers of
+	// certificates to revoke. The certificates are listed in the CRL stored
+	// in TLSCRLKey, and reported as revoked by the OCSP responder.
+	// Serial numbers not issued by the current CA are ignored, as its CRL is
+	// not authoritative for them. Serial numbers may be removed once the
+	// certificates have expired. CAs generated before revocation support
+	// can't sign CRLs, and publish none until they are rotated.
+	// See also RevokeCertificate.
+	RevokeCertificatesAnnotation = "revoke.cert-manager.io/serials"
+
+	// ServingCertificateSerialAnnotation is an annotation set on the Pod of
+	// each replica to the hex encoded serial number of its serving
+	// certificate, when Options.Pod is set.
+	ServingCertificateSerialAnnotation = "cert-manager.io/serving-certificate-serial"
+	// ServingCertificateFingerprintAnnotation is an annotation set on the Pod
+	// of each replica to the hex encoded SHA-256 fingerprint of its serving
+	// certificate, when Options.Pod is set.
+	ServingCertificateFingerprintAnnotation = "cert-manager.io/serving-certificate-sha256"
 )
 
 type ApplyConfiguration interface {
@@ -96,6 +133,113 @@ func (i *ValidatingWebhookCaBundleInject) InjectCA(obj *unstructured.Unstructure
 
 var _ Injectable = &ValidatingWebhookCaBundleInject{}
 
+// CABundleInjectable is an optional interface implemented by injectables
+// that publish more than the PEM encoded CA bundle, e.g. the certificate
+// revocation list of the CA. InjectCABundle is used instead of InjectCA.
+type CABundleInjectable interface {
+	Injectable
+	InjectCABundle(obj *unstructured.Unstructured, caBundle CABundle) (ApplyConfiguration, error)
+}
+
+// CABundle is the public data of the CA Secret, published to injectables.
+type CABundle struct {
+	// The PEM encoded CA bundle, stored in TLSCABundleKey.
+	PEM []byte
+
+	// The PEM encoded certificate revocation list of the CA, stored in
+	// TLSCRLKey.
+	CRL []byte
+
+	// The additional formats of the CA bundle configured in CABundleOptions,
+	// by data key.
+	Formats map[string][]byte
+}
+
+// +kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;patch
+
+// ConfigMapCaBundleInject injects the CA bundle into ConfigMaps, to
+// distribute it to workloads in any namespace. The additional formats of the
+// CA bundle configured in CABundleOptions are injected as binary data.
+type ConfigMapCaBundleInject struct {
+	// The data key of the CA bundle. Defaults to TLSCABundleKey.
+	Key string
+
+	// The data key of the certificate revocation list of the CA. If not set,
+	// the CRL is not published.
+	CRLKey string
+}
+
+func (i *ConfigMapCaBundleInject) GroupVersionKind() schema.GroupVersionKind {
+	return corev1.SchemeGroupVersion.WithKind("ConfigMap")
+}
+
+func (i *ConfigMapCaBundleInject) InjectCA(obj *unstructured.Unstructured, caBundle []byte) (ApplyConfiguration, error) {
+	return i.InjectCABundle(obj, CABundle{PEM: caBundle})
+}
+
+func (i *ConfigMapCaBundleInject) InjectCABundle(obj *unstructured.Unstructured, caBundle CABundle) (ApplyConfiguration, error) {
+	key := i.Key
+	if key == "" {
+		key = TLSCABundleKey
+	}
+	data := map[string]string{key: string(caBundle.PEM)}
+	if i.CRLKey != "" && len(caBundle.CRL) > 0 {
+		data[i.CRLKey] = string(caBundle.CRL)
+	}
+	ac := corev1ac.ConfigMap(obj.GetName(), obj.GetNamespace()).WithData(data)
+	// The additional formats are binary, and keep their CA Secret keys
+	if len(caBundle.Formats) > 0 {
+		ac.WithBinaryData(caBundle.Formats)
+	}
+	return ac, nil
+}
+
+var _ CABundleInjectable = &ConfigMapCaBundleInject{}
+
+// CABundleOptions is the retention policy of CA certificates in the CA
+// bundle, and the additional formats it is published in. Previous CAs are
+// retained after rotation, to keep certificates they issued trusted.
+type CABundleOptions struct {
+	// The maximum number of CA certificates in the CA bundle, including the
+	// current CA. The oldest CAs are pruned first. Defaults to 5.
+	MaxCertificates int
+
+	// The amount of time expired CA certificates are retained, to tolerate
+	// clock skew. Defaults to zero.
+	ExpiryGracePeriod time.Duration
+
+	// If set, the CA bundle is ordered by descending NotBefore, i.e. the
+	// current CA first, instead of by certificate hash.
+	NewestFirst bool
+
+	// If set, the CA bundle is also stored in the CA Secret as a PKCS#12
+	// truststore, and published to injectables supporting it.
+	PKCS12 *TrustStoreOptions
+
+	// If set, the CA bundle is also stored in the CA Secret as a JKS
+	// truststore, and published to injectables supporting it.
+	JKS *TrustStoreOptions
+
+	// If set, each certificate of the CA bundle is also stored in the CA
+	// Secret DER encoded, and published to injectables supporting it. The
+	// data key of each certificate is this prefix followed by its index in
+	// the CA bundle and ".der", e.g. "ca-0.der" for the prefix "ca-".
+	DERKeyPrefix string
+}
+
+// TrustStoreOptions configures a truststore format of the CA bundle. The
+// encoding is deterministic, so the truststore only changes with the CA
+// bundle or the password.
+type TrustStoreOptions struct {
+	// The data key of the truststore, e.g. "truststore.p12".
+	Key string
+
+	// An optional reference to the password of the truststore. The Secret
+	// must be in Namespace and labelled with DynamicAuthoritySecretLabel.
+	// Defaults to the password "changeit".
+	PasswordSecretRef *corev1.SecretKeySelector
+}
+
 type Options struct {
 	// The namespace used for certificate secrets.
 	Namespace string
@@ -104,23 +248,143 @@ type Options struct {
 	CASecret string
 
 	// The amount of time the root CA certificate will be valid for.
-	// This must be greater than LeafDuration.
+	// This must be greater than twice LeafDuration.
 	CADuration time.Duration
 
-	DNSNames []string
+	// The amount of time the certificate revocation list of the CA will be
+	// valid for. It is regenerated after 2/3 of this duration.
+	// Defaults to 24 hours.
+	CRLDuration time.Duration
+
+	// The retention policy of previous CA certificates in the CA bundle.
+	CABundle CABundleOptions
+
+	// The subject alternative names of the serving certificate.
+	// See ServiceDNSNames, ServiceIPAddresses and SPIFFEID for helpers to
+	// derive them.
+	DNSNames       []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+	EmailAddresses []string
+
+	// The identity of the Pod this replica runs in, see PodIdentityFromEnv.
+	// If set, the serving certificate of each replica also includes the DNS
+	// names and IPs of its Pod, and the serial number and fingerprint of the
+	// certificate are published as annotations on the Pod.
+	Pod *PodIdentity
+
+	// Additional serving certificates, selected by the SNI server name sent
+	// by clients. The certificate for DNSNames is served to clients that
+	// don't match any of them.
+	SNICertificates []SNICertificate
 
 	// The amount of time leaf certificates signed by this authority will be
 	// valid for.
-	// This must be less than CADuration.
+	// This must be less than half of CADuration.
 	LeafDuration time.Duration
 
+	// The amount of time the NotBefore of issued certificates, including the
+	// CA, is backdated to tolerate clock skew between nodes. The certificates
+	// are still valid for CADuration and LeafDuration from the time of issue.
+	// This must be less than a third of LeafDuration.
+	NotBeforeBackdate time.Duration
+
+	// Configures the checks of certificates before they are published.
+	Lint LintOptions
+
+	// The clock used for certificate validity, renewal and revocation times.
+	// Defaults to the real clock; intended to be replaced in tests.
+	Clock clock.PassiveClock
+
+	// The kinds to inject the CA bundle into. Defaults to
+	// ValidatingWebhookConfiguration.
+	// Kinds that are not served by the API server yet, e.g. kinds defined by
+	// CRDs that are not installed, are injected once they are discovered.
+	// See ServingCertificateOperator.InactiveInjectables.
 	Injectables []Injectable
+
+	// If set, injectables are also selected by the cert-manager cainjector
+	// InjectCAFromSecretAnnotation, allowing migration from cainjector without
+	// changing manifests. As annotations can't be filtered by the API server,
+	// all objects of the injectable kinds are cached. Injectables of kinds not
+	// served when the operator is set up are only selected by labels.
+	CAInjectorCompatibility bool
+
+	// An optional selector of the namespaces to inject namespaced
+	// injectables, e.g. ConfigMaps, in. By default, all namespaces are
+	// injected. Namespaces are watched, so injectables in a namespace are
+	// injected once it is labelled to match. Injectables in other namespaces
+	// are still cached, if labelled for injection, as the cache can only be
+	// scoped to a fixed set of namespaces, not to those matching a selector.
+	InjectableNamespaceSelector labels.Selector
+
+	// The interval to check for inactive injectable kinds being served by
+	// the API server. Defaults to 10 seconds.
+	InjectableDiscoveryInterval time.Duration
+
+	// An optional directory the serving certificate is written to, for
+	// consumers that read TLS material from files, e.g. a sidecar proxy.
+	// The leaf certificate followed by the issuing CA, the private key and the
+	// CA bundle are written to tls.crt, tls.key and ca.crt respectively. Files
+	// are replaced atomically using the same symlink layout as Secret volumes.
+	CertDir string
+
+	// The file mode of the files written to CertDir.
+	// Defaults to 0600.
+	CertFileMode os.FileMode
+
+	// Configures the OCSP responder and OCSP stapling of serving
+	// certificates.
+	OCSP OCSPOptions
+
+	// Configures the client certificate, see
+	// ServingCertificateOperator.ClientCertificate.
+	ClientCertificate ClientCertificateOptions
+
+	// The name of an optional Secret holding additional CA certificates
+	// trusted for client authentication, see
+	// ServingCertificateOperator.VerifyClientCertificate.
+	// The Secret must be in Namespace and labelled with
+	// DynamicAuthoritySecretLabel. The certificates are read from
+	// TLSCABundleKey, or from ca.crt if the former is not present.
+	ClientCASecret string
+}
+
+// SNICertificate describes a serving certificate selected by the SNI server
+// name sent by clients.
+type SNICertificate struct {
+	// The DNS names of the certificate, which are also the patterns matched
+	// against the SNI server name. A name may contain a wildcard as the
+	// left-most label, e.g. "*.example.com".
+	DNSNames []string
+
+	// The public key algorithm of the certificate; x509.ECDSA, x509.RSA or
+	// x509.Ed25519. Defaults to x509.ECDSA.
+	// Several certificates for the same DNS names, but with different key
+	// algorithms, can be used to serve clients based on the signature schemes
+	// they support.
+	KeyAlgorithm x509.PublicKeyAlgorithm
+}
+
+// ClientCertificateOptions configures the subject of the client certificate.
+type ClientCertificateOptions struct {
+	// The common name of the client certificate.
+	// Defaults to "cert-manager-dynamic-client".
+	CommonName string
+
+	// The organizations of the client certificate.
+	Organization []string
 }
 
 type ServingCertificateOperator struct {
 	Options Options
 
-	certificateHolder *CertificateHolder
+	certificateHolder       *CertificateHolder
+	clientCertificateHolder *CertificateHolder
+	clientCAHolder          *CABundleHolder
+	rootCAHolder            *CABundleHolder
+	ocspResponder           *OCSPResponder
+	injectableActivator     *injectableActivator
 }
 
 func (o *ServingCertificateOperator) ServingCertificate() func(config *tls.Config) {
@@ -134,23 +398,127 @@ func (o *ServingCertificateOperator) ServingCertificate() func(config *tls.Confi
 	}
 }
 
+// VerifyClientCertificate returns a tls.Config option that requires clients
+// to present a certificate signed by a CA in the dynamic CA bundle, or by a CA
+// in Options.ClientCASecret. The trusted CAs are refreshed on rotation,
+// without restarting the server.
+func (o *ServingCertificateOperator) VerifyClientCertificate() func(config *tls.Config) {
+	if o.clientCAHolder == nil {
+		o.clientCAHolder = &CABundleHolder{}
+	}
+	return func(config *tls.Config) {
+		config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			clientCAs, err := o.clientCAHolder.GetCertPool()
+			if err != nil {
+				return nil, err
+			}
+			clientConfig := config.Clone()
+			clientConfig.ClientCAs = clientCAs
+			clientConfig.ClientAuth = tls.RequireAndVerifyClientCert
+			return clientConfig, nil
+		}
+	}
+}
+
+// ClientCertificate returns a tls.Config option for clients that presents a
+// client certificate signed by the dynamic CA to servers requesting one, e.g.
+// servers using VerifyClientCertificate. The certificate is reissued on CA
+// rotation and renewed before it expires, without recreating the client.
+func (o *ServingCertificateOperator) ClientCertificate() func(config *tls.Config) {
+	if o.clientCertificateHolder == nil {
+		o.clientCertificateHolder = &CertificateHolder{}
+	}
+	return func(config *tls.Config) {
+		config.GetClientCertificate = func(info *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return o.clientCertificateHolder.GetClientCertificate(info)
+		}
+	}
+}
+
+// RootCAs returns a holder of the current dynamic CA bundle, to be used by
+// clients calling servers that use the ServingCertificate.
+func (o *ServingCertificateOperator) RootCAs() *CABundleHolder {
+	if o.rootCAHolder == nil {
+		o.rootCAHolder = &CABundleHolder{}
+	}
+	return o.rootCAHolder
+}
+
+// VerifyServerCertificate returns a tls.Config option for clients that
+// verifies the server certificate against the current dynamic CA bundle.
+// As opposed to tls.Config.RootCAs, the CA bundle is refreshed on rotation.
+// The server certificate is verified against the ServerName of the config
+// when the option is applied, or else the server name of the connection.
+// Connecting to a server by IP address requires ServerName to be set, e.g. to
+// the IP address. A VerifyConnection function already set on the config is
+// called after successful verification.
+func (o *ServingCertificateOperator) VerifyServerCertificate() func(config *tls.Config) {
+	rootCAs := o.RootCAs()
+	return func(config *tls.Config) {
+		// The standard verification is replaced by VerifyConnection below
+		config.InsecureSkipVerify = true //nolint:gosec
+		config.VerifyConnection = rootCAs.verifyConnection(config.ServerName, config.VerifyConnection)
+	}
+}
+
+// RoundTripper returns an http.RoundTripper based on the given transport,
+// that verifies servers against the current dynamic CA bundle and the host of
+// the request URL, which may be an IP address. The transport dials TLS
+// connections itself, so HTTPS proxies are not supported.
+// If transport is nil, a clone of http.DefaultTransport is used.
+func (o *ServingCertificateOperator) RoundTripper(transport *http.Transport) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	next := transport.TLSClientConfig.VerifyConnection
+	// Used for connections through HTTP proxies
+	o.VerifyServerCertificate()(transport.TLSClientConfig)
+	transport.DialTLSContext = o.rootCAHolder.dialTLSContext(transport, next)
+
+	return &caBundleRoundTripper{transport: transport, rootCAs: o.rootCAHolder}
+}
+
+// OCSPResponder returns an http.Handler answering OCSP requests for
+// certificates issued by the dynamic CA. It can be registered on the webhook
+// or metrics server of the manager, and its URL set in
+// Options.OCSP.ResponderURL.
+func (o *ServingCertificateOperator) OCSPResponder() http.Handler {
+	if o.ocspResponder == nil {
+		o.ocspResponder = &OCSPResponder{}
+	}
+	return o.ocspResponder
+}
+
+// InactiveInjectables returns the kinds of the injectables that are not
+// served by the API server, and thus not injected yet. Their controllers are
+// started once the kinds are discovered, e.g. when a CRD is installed.
+func (o *ServingCertificateOperator) InactiveInjectables() []schema.GroupVersionKind {
+	if o.injectableActivator == nil {
+		return nil
+	}
+	return o.injectableActivator.InactiveInjectables()
+}
+
 // +kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups="",resources=events,verbs=create;patch
 
+// SetupWithManager validates the options and sets up the controllers of the
+// dynamic authority with the manager. Injectables of kinds not served by the
+// API server only log a warning, instead of failing the setup, as their CRDs
+// may be installed after the operator. Their controllers are set up once the
+// kinds are served, see InactiveInjectables.
 func (o *ServingCertificateOperator) SetupWithManager(mgr ctrl.Manager) error {
 	if o.certificateHolder == nil {
 		return errors.New("ServingCertificate not invoked")
 	}
 
-	if o.Options.CADuration == 0 {
-		o.Options.CADuration = 7 * 24 * time.Hour
-	}
-	if o.Options.LeafDuration == 0 {
-		o.Options.LeafDuration = 1 * 24 * time.Hour
-	}
-	if len(o.Options.Injectables) == 0 {
-		o.Options.Injectables = []Injectable{
-			&ValidatingWebhookCaBundleInject{},
-		}
+	o.Options.setDefaults()
+	if err := o.Options.Validate(); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
 	}
 
 	cacheByObject := map[client.Object]cache.ByObject{
@@ -163,22 +531,49 @@ func (o *ServingCertificateOperator) SetupWithManager(mgr ctrl.Manager) error {
 			}),
 		},
 	}
-	injectByObject := cache.ByObject{
-		Label: labels.SelectorFromSet(labels.Set{
-			WantInjectFromSecretNamespaceLabel: o.Options.Namespace,
-			WantInjectFromSecretNameLabel:      o.Options.CASecret,
-		}),
+
+	if o.Options.InjectableNamespaceSelector != nil {
+		// Only the selected namespaces are cached, see InjectableReconciler.
+		// Injectables are not scoped to them, as cache.ByObject only takes
+		// fixed namespaces, and namespaces may be labelled after start. The
+		// injectable selector below limits the cache to labelled injectables.
+		cacheByObject[&corev1.Namespace{}] = cache.ByObject{
+			Label: o.Options.InjectableNamespaceSelector,
+		}
 	}
-	for _, injectable := range o.Options.Injectables {
-		cacheByObject[newUnstructured(injectable)] = injectByObject
+
+	// Injectables are cached using the default selector, as their kinds
+	// might not be served yet, see injectableActivator
+	injectableSelector := labels.SelectorFromSet(labels.Set{
+		WantInjectFromSecretNamespaceLabel: o.Options.Namespace,
+		WantInjectFromSecretNameLabel:      o.Options.CASecret,
+	})
+	if o.Options.CAInjectorCompatibility {
+		// Only the injectable kinds are cached unfiltered, as the cache
+		// configuration of a kind requires it to be served
+		for _, injectable := range o.Options.Injectables {
+			gvk := injectable.GroupVersionKind()
+			if _, err := mgr.GetRESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+				if meta.IsNoMatchError(err) {
+					continue
+				}
+				return err
+			}
+			cacheByObject[newUnstructured(injectable)] = cache.ByObject{Label: labels.Everything()}
+		}
 	}
+
 	controllerCache, err := cache.New(mgr.GetConfig(), cache.Options{
 		HTTPClient:                  mgr.GetHTTPClient(),
 		Scheme:                      mgr.GetScheme(),
 		Mapper:                      mgr.GetRESTMapper(),
 		ReaderFailOnMissingInformer: true,
 		ByObject:                    cacheByObject,
+		DefaultLabelSelector:        injectableSelector,
 	})
+	if err != nil {
+		return err
+	}
 	if err := mgr.Add(controllerCache); err != nil {
 		return err
 	}
@@ -197,16 +592,43 @@ func (o *ServingCertificateOperator) SetupWithManager(mgr ctrl.Manager) error {
 	}
 
 	r := reconciler{
-		Client: controllerClient,
-		Cache:  controllerCache,
-		Opts:   o.Options,
+		Client:    controllerClient,
+		APIReader: mgr.GetAPIReader(),
+		Cache:     controllerCache,
+		Recorder:  mgr.GetEventRecorderFor("dynamic-authority"),
+		Opts:      o.Options,
 	}
 	controllers := []dynamicAuthorityController{
 		&CASecretReconciler{reconciler: r},
 		&LeafCertReconciler{reconciler: r, certificateHolder: o.certificateHolder},
 	}
-	for _, injectable := range o.Options.Injectables {
-		controllers = append(controllers, &InjectableReconciler{reconciler: r, Injectable: injectable})
+	if o.clientCertificateHolder != nil {
+		controllers = append(controllers, &ClientCertReconciler{reconciler: r, certificateHolder: o.clientCertificateHolder})
+	}
+	if o.clientCAHolder != nil || o.rootCAHolder != nil || o.ocspResponder != nil {
+		controllers = append(controllers, &CABundleReconciler{
+			reconciler:     r,
+			clientCAHolder: o.clientCAHolder,
+			rootCAHolder:   o.rootCAHolder,
+			ocspResponder:  o.ocspResponder,
+		})
+	}
+	o.injectableActivator = &injectableActivator{
+		mapper: mgr.GetRESTMapper(),
+		setup: func(injectable Injectable) error {
+			return (&InjectableReconciler{reconciler: r, Injectable: injectable}).SetupWithManager(mgr)
+		},
+		interval: o.Options.InjectableDiscoveryInterval,
+	}
+	if err := o.injectableActivator.add(o.Options.Injectables); err != nil {
+		return err
+	}
+	if inactive := o.injectableActivator.InactiveInjectables(); len(inactive) > 0 {
+		// Not an error, but a misspelled kind would never be injected
+		mgr.GetLogger().WithName("dynamic-authority").Info("WARNING: injectable kinds are not served yet, and are injected once they are", "kinds", inactive)
+		if err := mgr.Add(o.injectableActivator); err != nil {
+			return err
+		}
 	}
 	for _, c := range controllers {
 		if err := c.SetupWithManager(mgr); err != nil {
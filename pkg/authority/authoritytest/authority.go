@@ -0,0 +1,195 @@
+// Package authoritytest provides an in-memory fake of the dynamic authority,
+// CA Secret builders and Gomega matchers, for unit tests of code consuming
+// pkg/authority without a Kubernetes API server.
+package authoritytest
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"slices"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/utils/clock"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+// Authority is an in-memory certificate authority issuing real certificates
+// signed like the dynamic authority does. It is safe for concurrent use.
+type Authority struct {
+	opts authority.Options
+
+	mu       sync.Mutex
+	caCert   *x509.Certificate
+	caPK     crypto.Signer
+	previous []*x509.Certificate
+}
+
+// New returns an Authority with a new CA. The options are used like the
+// dynamic authority does, with Namespace and CASecret naming the Secret
+// returned by CASecret. Unset durations default to those of the dynamic
+// authority.
+func New(opts authority.Options) (*Authority, error) {
+	if opts.CADuration == 0 {
+		opts.CADuration = 7 * 24 * time.Hour
+	}
+	if opts.LeafDuration == 0 {
+		opts.LeafDuration = 1 * 24 * time.Hour
+	}
+
+	a := &Authority{opts: opts}
+	if err := a.Rotate(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Rotate replaces the CA with a new one, like the dynamic authority does
+// when the CA is due for renewal. The previous CA is retained in the CA
+// bundle until it expires.
+func (a *Authority) Rotate() error {
+	return a.replaceCA(a.opts, true)
+}
+
+// Expire replaces the CA with one that has expired, and drops all previous
+// CAs. Issuing certificates fails until the CA is rotated.
+func (a *Authority) Expire() error {
+	opts := a.opts
+	// Generate the CA as if it was generated just over CADuration ago
+	opts.Clock = clocktesting.NewFakePassiveClock(a.now().Add(-opts.CADuration - time.Minute))
+	opts.NotBeforeBackdate = 0
+	return a.replaceCA(opts, false)
+}
+
+func (a *Authority) replaceCA(opts authority.Options, retain bool) error {
+	caCert, caPK, err := authority.GenerateCA(opts)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.previous = nil
+	if retain && a.caCert != nil {
+		pool := pki.NewCertPool(pki.WithFilteredExpiredCerts(true), pki.WithClock(a.clock()))
+		for _, c := range a.bundle() {
+			pool.AddCert(c)
+		}
+		a.previous = pool.Certificates()
+	}
+	a.caCert, a.caPK = caCert, caPK
+	return nil
+}
+
+// CACertificate returns the current CA certificate.
+func (a *Authority) CACertificate() *x509.Certificate {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.caCert
+}
+
+// CABundle returns the PEM encoded CA bundle, containing the current and
+// the unexpired previous CA certificates.
+func (a *Authority) CABundle() []byte {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pool := pki.NewCertPool()
+	for _, c := range a.bundle() {
+		pool.AddCert(c)
+	}
+	return []byte(pool.PEM())
+}
+
+// CASecret returns the CA Secret, as maintained by the dynamic authority.
+func (a *Authority) CASecret() (*corev1.Secret, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return NewCASecret(a.opts.Namespace, a.opts.CASecret, a.caCert, a.caPK, a.bundle()...)
+}
+
+// Issue issues a certificate for the subject and subject alternative names
+// in the given template, with a new ECDSA private key, using the certificate
+// profile matching its extended key usages; authority.ServerProfile if it
+// has none. The template is left unchanged.
+func (a *Authority) Issue(template *x509.Certificate) (*tls.Certificate, error) {
+	pk, err := pki.GenerateECPrivateKey(256)
+	if err != nil {
+		return nil, err
+	}
+
+	t := *template
+	template = &t
+	template.PublicKeyAlgorithm = x509.ECDSA
+	template.PublicKey = pk.Public()
+
+	a.mu.Lock()
+	caCertBytes, err := pki.EncodeX509(a.caCert)
+	if err != nil {
+		a.mu.Unlock()
+		return nil, err
+	}
+	caPkBytes, err := pki.EncodePrivateKey(a.caPK)
+	a.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := authority.SignWithProfile(a.opts, profile(template), template, caCertBytes, caPkBytes)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{
+		Certificate: [][]byte{cert.Raw},
+		PrivateKey:  pk,
+		Leaf:        cert,
+	}, nil
+}
+
+// CertificateHolder returns a CertificateHolder serving a certificate issued
+// for the given DNS names, like the one set up by
+// authority.ServingCertificateOperator.ServingCertificate.
+func (a *Authority) CertificateHolder(dnsNames ...string) (*authority.CertificateHolder, error) {
+	cert, err := a.Issue(&x509.Certificate{DNSNames: dnsNames})
+	if err != nil {
+		return nil, err
+	}
+	holder := &authority.CertificateHolder{}
+	holder.SetCertificate(cert)
+	return holder, nil
+}
+
+// bundle returns the current and previous CA certificates; a.mu must be
+// held.
+func (a *Authority) bundle() []*x509.Certificate {
+	return append([]*x509.Certificate{a.caCert}, a.previous...)
+}
+
+func (a *Authority) now() time.Time {
+	return a.clock().Now()
+}
+
+func (a *Authority) clock() clock.PassiveClock {
+	if a.opts.Clock == nil {
+		return clock.RealClock{}
+	}
+	return a.opts.Clock
+}
+
+// profile returns the certificate profile matching the extended key usages
+// of the template, defaulting to authority.ServerProfile.
+func profile(template *x509.Certificate) authority.CertificateProfile {
+	if len(template.ExtKeyUsage) == 0 {
+		return authority.ServerProfile()
+	}
+	for _, profile := range []authority.CertificateProfile{authority.ServerProfile(), authority.ClientProfile(), authority.PeerProfile()} {
+		if slices.Equal(template.ExtKeyUsage, profile.ExtKeyUsage) {
+			return profile
+		}
+	}
+	return authority.CertificateProfile{Name: "custom", ExtKeyUsage: template.ExtKeyUsage}
+}
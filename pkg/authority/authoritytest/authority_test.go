@@ -0,0 +1,114 @@
+package authoritytest
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+var _ = Describe("Authority", func() {
+	var a *Authority
+
+	BeforeEach(func() {
+		var err error
+		a, err = New(authority.Options{Namespace: "cert-manager", CASecret: "ca-cert"})
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	verify := func(cert *tls.Certificate) error {
+		roots := x509.NewCertPool()
+		roots.AppendCertsFromPEM(a.CABundle())
+		_, err := cert.Leaf.Verify(x509.VerifyOptions{Roots: roots, DNSName: "example.com"})
+		return err
+	}
+
+	It("should provide a CA Secret", func() {
+		secret, err := a.CASecret()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret).To(BeCASecret())
+		Expect(secret.Namespace).To(Equal("cert-manager"))
+		Expect(secret.Name).To(Equal("ca-cert"))
+
+		other, err := New(authority.Options{})
+		Expect(err).ToNot(HaveOccurred())
+		otherSecret, err := other.CASecret()
+		Expect(err).ToNot(HaveOccurred())
+		secret.Data[authority.TLSCABundleKey] = otherSecret.Data[authority.TLSCABundleKey]
+		Expect(secret).ToNot(BeCASecret())
+		secret.Data[corev1.TLSPrivateKeyKey] = otherSecret.Data[corev1.TLSPrivateKeyKey]
+		Expect(secret).ToNot(BeCASecret())
+	})
+
+	It("should issue certificates verified by the CA bundle", func() {
+		holder, err := a.CertificateHolder("example.com")
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := holder.GetCertificate(nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cert.Leaf).To(BeSignedBy(a.CACertificate()))
+		Expect(cert.Leaf.ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageServerAuth))
+		Expect(verify(cert)).To(Succeed())
+	})
+
+	It("should leave the template unchanged", func() {
+		template := &x509.Certificate{DNSNames: []string{"example.com"}}
+		_, err := a.Issue(template)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(template).To(Equal(&x509.Certificate{DNSNames: []string{"example.com"}}))
+	})
+
+	It("should retain the previous CA when rotated", func() {
+		cert, err := a.Issue(&x509.Certificate{DNSNames: []string{"example.com"}})
+		Expect(err).ToNot(HaveOccurred())
+		previous := a.CACertificate()
+
+		Expect(a.Rotate()).To(Succeed())
+		Expect(a.CACertificate()).ToNot(Equal(previous))
+		Expect(cert.Leaf).ToNot(BeSignedBy(a.CACertificate()))
+		Expect(verify(cert)).To(Succeed())
+
+		secret, err := a.CASecret()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret).To(BeCASecret())
+	})
+
+	It("should drop expired CAs from the CA bundle", func() {
+		fakeClock := clocktesting.NewFakePassiveClock(time.Now())
+		a, err := New(authority.Options{CADuration: time.Hour, LeafDuration: time.Minute, Clock: fakeClock})
+		Expect(err).ToNot(HaveOccurred())
+		caBundle := func() []*x509.Certificate {
+			certs, err := pki.DecodeX509CertificateSetBytes(a.CABundle())
+			Expect(err).ToNot(HaveOccurred())
+			return certs
+		}
+		first := a.CACertificate()
+
+		fakeClock.SetTime(first.NotBefore.Add(50 * time.Minute))
+		Expect(a.Rotate()).To(Succeed())
+		second := a.CACertificate()
+		Expect(caBundle()).To(ConsistOf(first, second))
+
+		fakeClock.SetTime(first.NotAfter.Add(time.Minute))
+		Expect(a.Rotate()).To(Succeed())
+		Expect(caBundle()).To(ConsistOf(second, a.CACertificate()))
+	})
+
+	It("should refuse to issue certificates when the CA expired", func() {
+		Expect(a.Expire()).To(Succeed())
+		Expect(a.CACertificate().NotAfter).To(BeTemporally("<", time.Now()))
+
+		_, err := a.Issue(&x509.Certificate{DNSNames: []string{"example.com"}})
+		Expect(err).To(MatchError(ContainSubstring("expired")))
+
+		Expect(a.Rotate()).To(Succeed())
+		_, err = a.Issue(&x509.Certificate{DNSNames: []string{"example.com"}})
+		Expect(err).ToNot(HaveOccurred())
+	})
+})
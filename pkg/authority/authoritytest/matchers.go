@@ -0,0 +1,34 @@
+package authoritytest
+
+import (
+	"crypto/x509"
+
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/erikgb/dynamic-authority/internal/pki/pkitest"
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+// BeCASecret succeeds if the actual *corev1.Secret is a CA Secret as
+// maintained by the dynamic authority: a labelled TLS Secret with a
+// self-signed CA certificate, its private key, and a CA bundle containing
+// the certificate.
+func BeCASecret() types.GomegaMatcher {
+	return And(
+		HaveField("Labels", HaveKeyWithValue(authority.DynamicAuthoritySecretLabel, "true")),
+		HaveField("Type", Equal(corev1.SecretTypeTLS)),
+		HaveField("Data", And(
+			pkitest.HaveKeyPair(corev1.TLSCertKey, corev1.TLSPrivateKeyKey),
+			pkitest.HaveCACertificate(corev1.TLSCertKey),
+			pkitest.HaveCertificateInBundle(corev1.TLSCertKey, authority.TLSCABundleKey),
+		)),
+	)
+}
+
+// BeSignedBy succeeds if the actual certificate, either an *x509.Certificate
+// or PEM encoded, is signed by the given CA certificate.
+func BeSignedBy(ca *x509.Certificate) types.GomegaMatcher {
+	return pkitest.BeSignedBy(ca)
+}
@@ -0,0 +1,47 @@
+package authoritytest
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+// NewCASecret returns a CA Secret in the layout maintained by the dynamic
+// authority, containing the given CA certificate and private key. The CA
+// bundle contains the given certificates, defaulting to the CA certificate.
+func NewCASecret(namespace, name string, caCert *x509.Certificate, caPK crypto.Signer, caBundle ...*x509.Certificate) (*corev1.Secret, error) {
+	certBytes, err := pki.EncodeX509(caCert)
+	if err != nil {
+		return nil, err
+	}
+	pkBytes, err := pki.EncodePrivateKey(caPK)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(caBundle) == 0 {
+		caBundle = []*x509.Certificate{caCert}
+	}
+	pool := pki.NewCertPool()
+	for _, c := range caBundle {
+		pool.AddCert(c)
+	}
+
+	secret := &corev1.Secret{}
+	secret.Namespace = namespace
+	secret.Name = name
+	secret.Labels = map[string]string{
+		authority.DynamicAuthoritySecretLabel: "true",
+	}
+	secret.Type = corev1.SecretTypeTLS
+	secret.Data = map[string][]byte{
+		corev1.TLSCertKey:        certBytes,
+		corev1.TLSPrivateKeyKey:  pkBytes,
+		authority.TLSCABundleKey: []byte(pool.PEM()),
+	}
+	return secret, nil
+}
@@ -0,0 +1,128 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+	pkierrors "github.com/erikgb/dynamic-authority/internal/pki/errors"
+)
+
+// CABundleReconciler keeps the trusted CA bundles and the OCSP responder in
+// sync with the CA Secret
+type CABundleReconciler struct {
+	reconciler
+	clientCAHolder *CABundleHolder
+	rootCAHolder   *CABundleHolder
+	ocspResponder  *OCSPResponder
+}
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *CABundleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	caSecretRequest := handler.TypedEnqueueRequestsFromMapFunc(func(context.Context, *corev1.Secret) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{
+			Namespace: r.Opts.Namespace,
+			Name:      r.Opts.CASecret,
+		}}}
+	})
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("cert_ca_bundle").
+		WatchesRawSource(r.caSecretSource(caSecretRequest)).
+		// Disable leader election since all replicas need the CA bundle and
+		// may serve OCSP requests
+		WithOptions(controller.TypedOptions[ctrl.Request]{NeedLeaderElection: ptr.To(false)})
+	if r.Opts.ClientCASecret != "" {
+		b = b.WatchesRawSource(r.secretSource(r.Opts.ClientCASecret, caSecretRequest))
+	}
+	return b.Complete(r)
+}
+
+func (r *CABundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	var clientCAs []*x509.Certificate
+	if r.clientCAHolder != nil {
+		var err error
+		if clientCAs, err = r.clientCAs(ctx); err != nil {
+			// Reported on the client CA Secret, as it is the one to be fixed
+			return ctrl.Result{}, r.handleError(newSecret(r.clientCASecretKey()), err)
+		}
+	}
+
+	requeueAfter, err := r.reconcileSecret(ctx, req, clientCAs)
+	return ctrl.Result{RequeueAfter: requeueAfter}, r.handleError(newSecret(req.NamespacedName), err)
+}
+
+func (r *CABundleReconciler) reconcileSecret(ctx context.Context, req ctrl.Request, clientCAs []*x509.Certificate) (time.Duration, error) {
+	caSecret := &corev1.Secret{}
+	if err := r.Get(ctx, req.NamespacedName, caSecret); err != nil {
+		if errors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	caBundle, err := pki.DecodeX509CertificateSetBytes(caSecret.Data[TLSCABundleKey])
+	if err != nil {
+		return 0, err
+	}
+
+	if r.rootCAHolder != nil {
+		r.rootCAHolder.SetCertificates(caBundle)
+	}
+	if r.clientCAHolder != nil {
+		r.clientCAHolder.SetCertificates(append(clientCAs, caBundle...))
+	}
+
+	if r.ocspResponder != nil {
+		return r.ocspResponder.setCA(r.Opts, caSecret.Data[corev1.TLSCertKey], caSecret.Data[corev1.TLSPrivateKeyKey], caSecret.Data[TLSCRLKey])
+	}
+
+	return 0, nil
+}
+
+// clientCAs returns the additional CA certificates trusted for client
+// authentication, if any.
+func (r *CABundleReconciler) clientCAs(ctx context.Context) ([]*x509.Certificate, error) {
+	if r.Opts.ClientCASecret == "" {
+		return nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, r.clientCASecretKey(), secret); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	caBundleBytes, ok := secret.Data[TLSCABundleKey]
+	if !ok {
+		caBundleBytes, ok = secret.Data[corev1.ServiceAccountRootCAKey]
+	}
+	if !ok {
+		return nil, pkierrors.NewInvalidData("client CA Secret %s has neither a %s nor a %s key",
+			client.ObjectKeyFromObject(secret), TLSCABundleKey, corev1.ServiceAccountRootCAKey)
+	}
+	clientCAs, err := pki.DecodeX509CertificateSetBytes(caBundleBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding client CA Secret %s: %w", client.ObjectKeyFromObject(secret), err)
+	}
+	return clientCAs, nil
+}
+
+func (r *CABundleReconciler) clientCASecretKey() types.NamespacedName {
+	return types.NamespacedName{Namespace: r.Opts.Namespace, Name: r.Opts.ClientCASecret}
+}
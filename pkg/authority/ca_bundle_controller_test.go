@@ -0,0 +1,222 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+var _ = Describe("CA Bundle Controller", Ordered, func() {
+	var (
+		opts           Options
+		caCert         *x509.Certificate
+		caPK           crypto.Signer
+		clientCACert   *x509.Certificate
+		clientCAHolder *CABundleHolder
+		rootCAHolder   *CABundleHolder
+	)
+
+	newCASecret := func(name string, dataKey string, cert *x509.Certificate) *corev1.Secret {
+		certBytes, err := pki.EncodeX509(cert)
+		Expect(err).ToNot(HaveOccurred())
+
+		secret := &corev1.Secret{}
+		secret.Namespace = opts.Namespace
+		secret.Name = name
+		secret.Labels = map[string]string{
+			DynamicAuthoritySecretLabel: "true",
+		}
+		secret.Data = map[string][]byte{
+			dataKey: certBytes,
+		}
+		return secret
+	}
+
+	BeforeAll(func() {
+		opts = Options{
+			Namespace:      "ca-bundle-controller",
+			CASecret:       "ca-cert",
+			ClientCASecret: "client-ca-cert",
+			CADuration:     7 * time.Hour,
+		}
+
+		ns := &corev1.Namespace{}
+		ns.Name = opts.Namespace
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		var err error
+		caCert, caPK, err = GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		clientCACert, _, err = GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(k8sClient.Create(ctx, newCASecret(opts.CASecret, TLSCABundleKey, caCert))).To(Succeed())
+
+		k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme: scheme.Scheme,
+			Metrics: metricsserver.Options{
+				BindAddress: "0",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		clientCAHolder = &CABundleHolder{}
+		rootCAHolder = &CABundleHolder{}
+		controller := &CABundleReconciler{
+			reconciler: reconciler{
+				Client: k8sManager.GetClient(),
+				Cache:  k8sManager.GetCache(),
+				Opts:   opts,
+			},
+			clientCAHolder: clientCAHolder,
+			rootCAHolder:   rootCAHolder,
+		}
+		Expect(controller.SetupWithManager(k8sManager)).To(Succeed())
+
+		go func() {
+			defer GinkgoRecover()
+			err = k8sManager.Start(ctx)
+			Expect(err).ToNot(HaveOccurred(), "failed to run manager")
+		}()
+	})
+
+	It("should trust the dynamic CA bundle", func() {
+		Eventually(clientCAHolder.GetCertPool).Should(And(
+			WithTransform(verifies(caCert), Succeed()),
+			WithTransform(verifies(clientCACert), Not(Succeed())),
+		))
+	})
+
+	It("should set root CAs from the dynamic CA bundle", func() {
+		Eventually(rootCAHolder.GetCertPool).Should(
+			WithTransform(verifies(caCert), Succeed()),
+		)
+	})
+
+	It("should verify servers against the dynamic CA bundle", func() {
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caPKBytes, err := pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		pk, err := pki.GenerateECPrivateKey(pki.ECCurve256)
+		Expect(err).ToNot(HaveOccurred())
+		leaf, err := Sign(Options{LeafDuration: time.Hour}, &x509.Certificate{
+			PublicKey:   pk.Public(),
+			IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+			KeyUsage:    x509.KeyUsageDigitalSignature,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}, caCertBytes, caPKBytes)
+		Expect(err).ToNot(HaveOccurred())
+
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{{
+			Certificate: [][]byte{leaf.Raw},
+			PrivateKey:  pk,
+		}}}
+		server.StartTLS()
+		defer func() {
+			server.Close()
+		}()
+
+		operator := &ServingCertificateOperator{rootCAHolder: rootCAHolder}
+		httpClient := &http.Client{Transport: operator.RoundTripper(nil)}
+		Eventually(httpClient.Get).WithArguments(server.URL).Should(
+			HaveField("StatusCode", Equal(http.StatusNoContent)),
+		)
+
+		By("rejecting servers not signed by the CA bundle")
+		server.Close()
+		server = httptest.NewTLSServer(server.Config.Handler)
+		_, err = httpClient.Get(server.URL)
+		Expect(err).To(MatchError(ContainSubstring("certificate signed by unknown authority")))
+	})
+
+	It("should trust the client CA once it is created", func() {
+		Expect(k8sClient.Create(ctx, newCASecret(opts.ClientCASecret, corev1.ServiceAccountRootCAKey, clientCACert))).To(Succeed())
+
+		Eventually(clientCAHolder.GetCertPool).Should(And(
+			WithTransform(verifies(caCert), Succeed()),
+			WithTransform(verifies(clientCACert), Succeed()),
+		))
+	})
+})
+
+func verifies(cert *x509.Certificate) func(*x509.CertPool) error {
+	return func(roots *x509.CertPool) error {
+		_, err := cert.Verify(x509.VerifyOptions{
+			Roots:     roots,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		return err
+	}
+}
+
+var _ = Describe("CA Bundle Reconciler", func() {
+	It("should report a client CA Secret without a CA bundle", func() {
+		opts := Options{
+			Namespace:      "cert-manager",
+			CASecret:       "ca-cert",
+			ClientCASecret: "client-ca-cert",
+			CADuration:     time.Hour,
+		}
+		caCert, _, err := GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+
+		caSecret := newSecret(types.NamespacedName{Namespace: opts.Namespace, Name: opts.CASecret})
+		caSecret.Data = map[string][]byte{TLSCABundleKey: caCertBytes}
+		clientCASecret := newSecret(types.NamespacedName{Namespace: opts.Namespace, Name: opts.ClientCASecret})
+		clientCASecret.Data = map[string][]byte{"ca.pem": caCertBytes}
+
+		recorder := &objectRecorder{EventRecorder: record.NewFakeRecorder(10)}
+		r := &CABundleReconciler{
+			reconciler: reconciler{
+				Client:   fake.NewClientBuilder().WithObjects(caSecret, clientCASecret).Build(),
+				Recorder: recorder,
+				Opts:     opts,
+			},
+			clientCAHolder: &CABundleHolder{},
+		}
+
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(caSecret)})
+		Expect(err).To(MatchError(reconcile.TerminalError(nil)))
+		Expect(err).To(MatchError(ContainSubstring("client CA Secret cert-manager/client-ca-cert has neither")))
+		Expect(recorder.EventRecorder.(*record.FakeRecorder).Events).To(Receive(HavePrefix("Warning InvalidData")))
+		Expect(recorder.objects).To(ConsistOf(client.ObjectKeyFromObject(clientCASecret)))
+	})
+})
+
+// objectRecorder records the keys of the objects Events are recorded on.
+type objectRecorder struct {
+	record.EventRecorder
+	objects []client.ObjectKey
+}
+
+func (r *objectRecorder) Event(obj runtime.Object, eventtype, reason, message string) {
+	r.objects = append(r.objects, client.ObjectKeyFromObject(obj.(client.Object)))
+	r.EventRecorder.Event(obj, eventtype, reason, message)
+}
@@ -0,0 +1,151 @@
+package authority
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+// hasFormats returns true if any additional format of the CA bundle is
+// configured.
+func (o CABundleOptions) hasFormats() bool {
+	return o.PKCS12 != nil || o.JKS != nil || o.DERKeyPrefix != ""
+}
+
+// passwordSecrets returns the names of the Secrets referenced for truststore
+// passwords.
+func (o CABundleOptions) passwordSecrets() []string {
+	var names []string
+	for _, ts := range []*TrustStoreOptions{o.PKCS12, o.JKS} {
+		if ts != nil && ts.PasswordSecretRef != nil && ts.PasswordSecretRef.Name != "" {
+			names = append(names, ts.PasswordSecretRef.Name)
+		}
+	}
+	return names
+}
+
+// isFormatKey returns true if key is the data key of an additional format of
+// the CA bundle.
+func (o CABundleOptions) isFormatKey(key string) bool {
+	return o.PKCS12 != nil && key == o.PKCS12.Key || o.JKS != nil && key == o.JKS.Key || o.isDERKey(key)
+}
+
+// isDERKey returns true if key is the data key of a DER encoded certificate
+// of the CA bundle.
+func (o CABundleOptions) isDERKey(key string) bool {
+	if o.DERKeyPrefix == "" {
+		return false
+	}
+	index, ok := strings.CutPrefix(key, o.DERKeyPrefix)
+	if !ok {
+		return false
+	}
+	index, ok = strings.CutSuffix(index, ".der")
+	if !ok {
+		return false
+	}
+	_, err := strconv.ParseUint(index, 10, 32)
+	return err == nil
+}
+
+// formats returns the additional formats of the CA bundle in the given data
+// of the CA Secret, by data key.
+func (o CABundleOptions) formats(data map[string][]byte) map[string][]byte {
+	if !o.hasFormats() {
+		return nil
+	}
+	formats := map[string][]byte{}
+	for key, value := range data {
+		if o.isFormatKey(key) {
+			formats[key] = value
+		}
+	}
+	return formats
+}
+
+// derKey returns the data key of the DER encoded certificate with the given
+// index in the CA bundle.
+func (o CABundleOptions) derKey(index int) string {
+	return fmt.Sprintf("%s%d.der", o.DERKeyPrefix, index)
+}
+
+// encodeCABundleFormats encodes the PEM encoded CA bundle in the additional
+// formats configured in Options.CABundle, by data key.
+func (r reconciler) encodeCABundleFormats(ctx context.Context, caBundleBytes []byte) (map[string][]byte, error) {
+	opts := r.Opts.CABundle
+	if !opts.hasFormats() {
+		return nil, nil
+	}
+
+	certs, err := pki.DecodeX509CertificateSetBytes(caBundleBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	formats := map[string][]byte{}
+	if opts.PKCS12 != nil {
+		password, err := r.trustStorePassword(ctx, opts.PKCS12)
+		if err != nil {
+			return nil, err
+		}
+		if formats[opts.PKCS12.Key], err = pki.EncodePKCS12TrustStore(certs, password); err != nil {
+			return nil, err
+		}
+	}
+	if opts.JKS != nil {
+		password, err := r.trustStorePassword(ctx, opts.JKS)
+		if err != nil {
+			return nil, err
+		}
+		if formats[opts.JKS.Key], err = pki.EncodeJKSTrustStore(certs, password); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DERKeyPrefix != "" {
+		for i, cert := range certs {
+			formats[opts.derKey(i)] = cert.Raw
+		}
+	}
+
+	return formats, nil
+}
+
+// trustStorePassword returns the password of the given truststore. The
+// password Secret is read from the API server, as an unlabelled Secret isn't
+// cached and would look missing; it is refused instead, as its changes
+// aren't watched.
+func (r reconciler) trustStorePassword(ctx context.Context, ts *TrustStoreOptions) (string, error) {
+	ref := ts.PasswordSecretRef
+	if ref == nil {
+		return pki.DefaultTrustStorePassword, nil
+	}
+
+	optional := ptr.Deref(ref.Optional, false)
+	secret := &corev1.Secret{}
+	if err := r.apiReader().Get(ctx, types.NamespacedName{Namespace: r.Opts.Namespace, Name: ref.Name}, secret); err != nil {
+		if errors.IsNotFound(err) && optional {
+			return pki.DefaultTrustStorePassword, nil
+		}
+		return "", fmt.Errorf("failed getting password Secret of truststore %s: %w", ts.Key, err)
+	}
+	if secret.Labels[DynamicAuthoritySecretLabel] != "true" {
+		return "", fmt.Errorf("password Secret %s of truststore %s is not labelled with %s", ref.Name, ts.Key, DynamicAuthoritySecretLabel)
+	}
+
+	password, ok := secret.Data[ref.Key]
+	if !ok {
+		if optional {
+			return pki.DefaultTrustStorePassword, nil
+		}
+		return "", fmt.Errorf("password Secret %s of truststore %s has no key %s", ref.Name, ts.Key, ref.Key)
+	}
+	return string(password), nil
+}
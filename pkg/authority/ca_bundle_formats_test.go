@@ -0,0 +1,137 @@
+package authority
+
+import (
+	"crypto/sha1" //nolint:gosec // SHA-1 is mandated by the JKS format
+	"crypto/x509"
+	"encoding/binary"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/utils/ptr"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"software.sslmate.com/src/go-pkcs12"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+var _ = Describe("CA bundle formats", func() {
+	var (
+		r        *CASecretReconciler
+		cas      []*x509.Certificate
+		caBundle []byte
+	)
+
+	BeforeEach(func() {
+		password := &corev1.Secret{}
+		password.Namespace = "cert-manager"
+		password.Name = "truststore-password"
+		password.Labels = map[string]string{DynamicAuthoritySecretLabel: "true"}
+		password.Data = map[string][]byte{"password": []byte("s3cret")}
+
+		r = &CASecretReconciler{reconciler: reconciler{
+			Client: fake.NewClientBuilder().WithObjects(password).Build(),
+			Opts: Options{
+				Namespace:  password.Namespace,
+				CADuration: 7 * 24 * time.Hour,
+				CABundle: CABundleOptions{
+					PKCS12: &TrustStoreOptions{Key: "truststore.p12", PasswordSecretRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: password.Name},
+						Key:                  "password",
+					}},
+					JKS:          &TrustStoreOptions{Key: "truststore.jks"},
+					DERKeyPrefix: "ca-",
+				},
+			},
+		}}
+
+		cas = nil
+		caBundle = nil
+		for range 2 {
+			caCert, _, err := GenerateCA(r.Opts)
+			Expect(err).ToNot(HaveOccurred())
+			caBytes, err := pki.EncodeX509(caCert)
+			Expect(err).ToNot(HaveOccurred())
+			cas = append(cas, caCert)
+			caBundle = append(caBundle, caBytes...)
+		}
+	})
+
+	It("should encode the CA bundle in the configured formats", func() {
+		formats, err := r.encodeCABundleFormats(ctx, caBundle)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(formats).To(HaveLen(4))
+
+		trusted, err := pkcs12.DecodeTrustStore(formats["truststore.p12"], "s3cret")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(trusted).To(HaveLen(2))
+		Expect(trusted[0].Equal(cas[0])).To(BeTrue())
+		Expect(trusted[1].Equal(cas[1])).To(BeTrue())
+
+		jks := formats["truststore.jks"]
+		Expect(binary.BigEndian.Uint32(jks)).To(Equal(uint32(0xFEEDFEED)))
+		Expect(binary.BigEndian.Uint32(jks[8:])).To(Equal(uint32(2)), "number of entries")
+		Expect(jks).To(ContainSubstring(string(cas[0].Raw)))
+		Expect(jks).To(ContainSubstring(string(cas[1].Raw)))
+		Expect(jks[len(jks)-sha1.Size:]).To(Equal(jksDigest(jks[:len(jks)-sha1.Size], pki.DefaultTrustStorePassword)))
+
+		Expect(formats).To(HaveKeyWithValue("ca-0.der", cas[0].Raw))
+		Expect(formats).To(HaveKeyWithValue("ca-1.der", cas[1].Raw))
+	})
+
+	It("should encode deterministically", func() {
+		formats, err := r.encodeCABundleFormats(ctx, caBundle)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(r.encodeCABundleFormats(ctx, caBundle)).To(Equal(formats))
+	})
+
+	It("should fail when the password is missing", func() {
+		r.Opts.CABundle.PKCS12.PasswordSecretRef.Key = "missing"
+		_, err := r.encodeCABundleFormats(ctx, caBundle)
+		Expect(err).To(MatchError(ContainSubstring("has no key missing")))
+
+		r.Opts.CABundle.PKCS12.PasswordSecretRef.Optional = ptr.To(true)
+		Expect(r.encodeCABundleFormats(ctx, caBundle)).To(HaveKey("truststore.p12"))
+	})
+
+	It("should fail when the password Secret is not labelled", func() {
+		password := &corev1.Secret{}
+		Expect(r.Get(ctx, types.NamespacedName{Namespace: "cert-manager", Name: "truststore-password"}, password)).To(Succeed())
+		password.Labels = nil
+		Expect(r.Update(ctx, password)).To(Succeed())
+		r.Opts.CABundle.PKCS12.PasswordSecretRef.Optional = ptr.To(true)
+
+		_, err := r.encodeCABundleFormats(ctx, caBundle)
+		Expect(err).To(MatchError(ContainSubstring("is not labelled with " + DynamicAuthoritySecretLabel)))
+	})
+
+	It("should only publish the formats of the CA Secret", func() {
+		formats, err := r.encodeCABundleFormats(ctx, caBundle)
+		Expect(err).ToNot(HaveOccurred())
+		data := map[string][]byte{
+			corev1.TLSCertKey:       []byte("CA cert"),
+			corev1.TLSPrivateKeyKey: []byte("CA key"),
+			TLSCABundleKey:          caBundle,
+			"ca-other.der":          []byte("other"),
+		}
+		for k, v := range formats {
+			data[k] = v
+		}
+		Expect(r.Opts.CABundle.formats(data)).To(Equal(formats))
+	})
+})
+
+// jksDigest returns the integrity digest of a JKS keystore, keyed by the
+// password.
+func jksDigest(data []byte, password string) []byte {
+	digest := sha1.New() //nolint:gosec // SHA-1 is mandated by the JKS format
+	for _, c := range password {
+		digest.Write([]byte{0, byte(c)})
+	}
+	digest.Write([]byte("Mighty Aphrodite"))
+	digest.Write(data)
+	return digest.Sum(nil)
+}
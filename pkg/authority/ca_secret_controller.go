@@ -4,15 +4,20 @@ import (
 	"context"
 	"crypto"
 	"crypto/x509"
+	"maps"
+	"strings"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
 	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/erikgb/dynamic-authority/internal/pki"
@@ -36,26 +41,37 @@ func (r *CASecretReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		r.events <- event.TypedGenericEvent[*corev1.Secret]{Object: obj}
 	}()
 
-	return ctrl.NewControllerManagedBy(mgr).
+	b := ctrl.NewControllerManagedBy(mgr).
 		Named("cert_ca_secret").
 		WatchesRawSource(r.caSecretSource(&handler.TypedEnqueueRequestForObject[*corev1.Secret]{})).
 		WatchesRawSource(
 			source.Channel(
 				r.events,
 				&handler.TypedEnqueueRequestForObject[*corev1.Secret]{}),
-		).
-		Complete(r)
+		)
+	// Truststores are encoded again when their password changes
+	caSecretRequest := handler.TypedEnqueueRequestsFromMapFunc(func(context.Context, *corev1.Secret) []reconcile.Request {
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{
+			Namespace: r.Opts.Namespace,
+			Name:      r.Opts.CASecret,
+		}}}
+	})
+	for _, name := range r.Opts.CABundle.passwordSecrets() {
+		b = b.WatchesRawSource(r.secretSource(name, caSecretRequest))
+	}
+	return b.Complete(r)
 }
 
 func (r *CASecretReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	return ctrl.Result{}, r.reconcileSecret(ctx, req)
+	requeueAfter, err := r.reconcileSecret(ctx, req)
+	return ctrl.Result{RequeueAfter: requeueAfter}, r.handleError(newSecret(req.NamespacedName), err)
 }
 
-func (r *CASecretReconciler) reconcileSecret(ctx context.Context, req ctrl.Request) error {
+func (r *CASecretReconciler) reconcileSecret(ctx context.Context, req ctrl.Request) (time.Duration, error) {
 	secret := &corev1.Secret{}
 	if err := r.Get(ctx, req.NamespacedName, secret); err != nil {
 		if !errors.IsNotFound(err) {
-			return err
+			return 0, err
 		}
 		// Secret does not exist - let's create it
 		secret.Namespace = req.Namespace
@@ -66,63 +82,149 @@ func (r *CASecretReconciler) reconcileSecret(ctx context.Context, req ctrl.Reque
 
 	if generate || secret.Annotations[RenewCertificateSecretAnnotation] != secret.Annotations[RenewHandledCertificateSecretAnnotation] {
 		var err error
-		cert, pk, err = generateCA(r.Opts)
+		cert, pk, err = GenerateCA(r.Opts)
 		if err != nil {
-			return err
+			return 0, err
+		}
+		if err := r.lint(ctx, cert, cert); err != nil {
+			return 0, err
 		}
 	}
 
+	data, pruned, requeueAfter, err := r.caSecretData(ctx, secret, cert, pk)
+	if err != nil {
+		return 0, err
+	}
+	// Failing to encode the additional formats, e.g. as a password Secret is
+	// missing, must not block CA rotation. The previous formats may lack the
+	// current CA, so they are dropped, and the error is returned after
+	// applying the Secret to retry.
+	formats, formatsErr := r.encodeCABundleFormats(ctx, data[TLSCABundleKey])
+	maps.Copy(data, formats)
+
+	ac := caSecretApplyConfiguration(secret, data)
+
+	if caRenewAfter := renewAfter(r.Opts.clock(), cert); caRenewAfter < requeueAfter {
+		requeueAfter = caRenewAfter
+	}
+
+	if err := r.Patch(ctx, secret, newApplyPatch(ac), client.ForceOwnership, fieldOwner); err != nil {
+		return 0, err
+	}
+	if len(pruned) > 0 {
+		r.reportPruned(ctx, secret, pruned)
+	}
+	return requeueAfter, formatsErr
+}
+
+// caSecretData returns the data of the CA Secret for the given CA, except
+// the additional formats of the CA bundle, based on the current data of
+// secret. It also returns the CAs pruned from the CA bundle, and the amount
+// of time after which the CRL must be regenerated.
+func (r *CASecretReconciler) caSecretData(ctx context.Context, secret *corev1.Secret, cert *x509.Certificate, pk crypto.Signer) (map[string][]byte, []*x509.Certificate, time.Duration, error) {
 	certBytes, err := pki.EncodeX509(cert)
 	if err != nil {
-		return err
+		return nil, nil, 0, err
 	}
 	pkBytes, err := pki.EncodePrivateKey(pk)
 	if err != nil {
-		return err
+		return nil, nil, 0, err
 	}
 
-	caBundleBytes, err := r.reconcileCABundle(secret.Data[TLSCABundleKey], cert)
+	caBundleBytes, pruned, err := r.reconcileCABundle(secret.Data[TLSCABundleKey], cert)
 	if err != nil {
 		log.FromContext(ctx).V(1).Error(err, "when reconciling CA bundle")
 		caBundleBytes = certBytes
 	}
 
+	data := map[string][]byte{
+		corev1.TLSCertKey:       certBytes,
+		corev1.TLSPrivateKeyKey: pkBytes,
+		TLSCABundleKey:          caBundleBytes,
+	}
+
+	// CAs generated before revocation support can't sign CRLs. Rather than
+	// rotating them on upgrade, they publish no CRL until they are rotated
+	// after 2/3 of their lifetime.
+	if cert.KeyUsage&x509.KeyUsageCRLSign == 0 {
+		log.FromContext(ctx).Info("CA can't sign CRLs, publishing no CRL until it is rotated")
+		return data, pruned, renewAfter(r.Opts.clock(), cert), nil
+	}
+
+	crlBytes, requeueAfter, err := generateCRL(r.Opts, secret, cert, pk)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	data[TLSCRLKey] = crlBytes
+
+	return data, pruned, requeueAfter, nil
+}
+
+// caSecretApplyConfiguration returns the ApplyConfiguration of the CA Secret
+// with the given data, acknowledging any renewal requested on secret.
+func caSecretApplyConfiguration(secret *corev1.Secret, data map[string][]byte) *corev1ac.SecretApplyConfiguration {
 	ac := corev1ac.Secret(secret.Name, secret.Namespace).
 		WithLabels(map[string]string{
 			DynamicAuthoritySecretLabel: "true",
 		}).
 		WithType(corev1.SecretTypeTLS).
-		WithData(map[string][]byte{
-			corev1.TLSCertKey:       certBytes,
-			corev1.TLSPrivateKeyKey: pkBytes,
-			TLSCABundleKey:          caBundleBytes,
-		})
+		WithData(data)
 
 	if v, ok := secret.Annotations[RenewCertificateSecretAnnotation]; ok {
 		ac.WithAnnotations(map[string]string{
 			RenewHandledCertificateSecretAnnotation: v,
 		})
 	}
-
-	return r.Patch(ctx, secret, newApplyPatch(ac), client.ForceOwnership, fieldOwner)
+	return ac
 }
 
-func (r *CASecretReconciler) reconcileCABundle(caBundleBytes []byte, caCert *x509.Certificate) ([]byte, error) {
-	certPool := pki.NewCertPool(pki.WithFilteredExpiredCerts(true))
-
+// reconcileCABundle returns the CA bundle containing the given CA and the
+// previous CAs retained by the retention policy, and the pruned CAs.
+func (r *CASecretReconciler) reconcileCABundle(caBundleBytes []byte, caCert *x509.Certificate) ([]byte, []*x509.Certificate, error) {
+	ordering := pki.OrderByHash
+	if r.Opts.CABundle.NewestFirst {
+		ordering = pki.OrderNewestFirst
+	}
+	certPool := pki.NewCertPool(
+		pki.WithFilteredExpiredCerts(true),
+		pki.WithExpiryGracePeriod(r.Opts.CABundle.ExpiryGracePeriod),
+		pki.WithMaxCertificates(r.Opts.CABundle.MaxCertificates),
+		pki.WithOrdering(ordering),
+		pki.WithClock(r.Opts.clock()),
+	)
+
+	var pruned []*x509.Certificate
 	if len(caBundleBytes) > 0 {
 		caBundle, err := pki.DecodeX509CertificateSetBytes(caBundleBytes)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		for _, c := range caBundle {
-			certPool.AddCert(c)
+			if !certPool.AddCert(c) {
+				pruned = append(pruned, c)
+			}
 		}
 	}
 
+	// The current CA is the newest, and is never pruned
 	certPool.AddCert(caCert)
+	pruned = append(pruned, certPool.Prune()...)
+
+	return []byte(certPool.PEM()), pruned, nil
+}
 
-	return []byte(certPool.PEM()), nil
+// reportPruned logs and records an Event for the CAs pruned from the CA
+// bundle of secret.
+func (r *CASecretReconciler) reportPruned(ctx context.Context, secret *corev1.Secret, pruned []*x509.Certificate) {
+	serials := make([]string, 0, len(pruned))
+	for _, c := range pruned {
+		serials = append(serials, c.SerialNumber.Text(16))
+	}
+	log.FromContext(ctx).Info("Pruned CA certificates from the CA bundle", "serials", serials)
+	if r.Recorder != nil {
+		r.Recorder.Eventf(secret, corev1.EventTypeNormal, "CABundlePruned",
+			"Pruned %d CA certificates from the CA bundle: %s", len(pruned), strings.Join(serials, ", "))
+	}
 }
 
 func (r *CASecretReconciler) needsGenerate(secret *corev1.Secret) (bool, *x509.Certificate, crypto.Signer) {
@@ -140,6 +242,11 @@ func (r *CASecretReconciler) needsGenerate(secret *corev1.Secret) (bool, *x509.C
 		return true, nil, nil
 	}
 
-	// TODO: Trigger renew check due
+	// Rotate the CA after 2/3 of its lifetime, leaving the previous CA in
+	// the bundle until it expires
+	if renewAfter(r.Opts.clock(), cert) <= 0 {
+		return true, nil, nil
+	}
+
 	return false, cert, pk
 }
@@ -1,6 +1,10 @@
 package authority
 
 import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -9,6 +13,8 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -45,9 +51,11 @@ var _ = Describe("CA Secret Controller", Ordered, func() {
 				Client: k8sManager.GetClient(),
 				Cache:  k8sManager.GetCache(),
 				Opts: Options{
-					Namespace:  caSecretRef.Namespace,
-					CASecret:   caSecretRef.Name,
-					CADuration: 7 * time.Hour,
+					Namespace:    caSecretRef.Namespace,
+					CASecret:     caSecretRef.Name,
+					CADuration:   7 * time.Hour,
+					LeafDuration: 1 * time.Hour,
+					CRLDuration:  1 * time.Hour,
 				}}}
 		Expect(controller.SetupWithManager(k8sManager)).To(Succeed())
 
@@ -120,4 +128,229 @@ var _ = Describe("CA Secret Controller", Ordered, func() {
 		Expect(err).ToNot(HaveOccurred())
 		Expect(caBundleCerts).To(HaveLen(2))
 	})
+
+	It("should publish CRL with revoked certificates", func() {
+		assertCASecret(caSecret)
+		Expect(caSecret.Data).To(HaveKey(TLSCRLKey))
+
+		By("revoking a certificate")
+		caPK, err := pki.DecodePrivateKeyBytes(caSecret.Data[corev1.TLSPrivateKeyKey])
+		Expect(err).ToNot(HaveOccurred())
+		serialNumber, err := newSerialNumber(caPK)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(RevokeCertificate(ctx, k8sClient, caSecretRef, serialNumber)).To(Succeed())
+		Expect(RevokeCertificate(ctx, k8sClient, caSecretRef, serialNumber)).To(Succeed())
+
+		Eventually(func(g Gomega) {
+			g.Expect(komega.Get(caSecret)()).To(Succeed())
+			g.Expect(caSecret.Annotations).To(HaveKeyWithValue(RevokeCertificatesAnnotation, serialNumber.Text(16)))
+			crl, err := pki.DecodeX509RevocationListBytes(caSecret.Data[TLSCRLKey])
+			g.Expect(err).ToNot(HaveOccurred())
+			caCert, err := pki.DecodeX509CertificateBytes(caSecret.Data[corev1.TLSCertKey])
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(crl.CheckSignatureFrom(caCert)).To(Succeed())
+			g.Expect(crl.RevokedCertificateEntries).To(ConsistOf(
+				HaveField("SerialNumber", Equal(serialNumber)),
+			))
+		}).Should(Succeed())
+
+		By("checking for reconcile loops")
+		resourceVersion := caSecret.ResourceVersion
+		Consistently(komega.Object(caSecret)).Should(
+			HaveField("ResourceVersion", Equal(resourceVersion)),
+		)
+	})
+})
+
+var _ = Describe("CA rotation", func() {
+	It("should rotate the CA and prune expired CAs over several weeks", func() {
+		ns := &corev1.Namespace{}
+		ns.Name = "cert-ca-rotation"
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		fakeClock := clocktesting.NewFakePassiveClock(time.Now())
+		recorder := record.NewFakeRecorder(10)
+		r := &CASecretReconciler{reconciler: reconciler{
+			Client:   k8sClient,
+			Recorder: recorder,
+			Opts: Options{
+				Namespace:    ns.Name,
+				CASecret:     "ca-cert",
+				CADuration:   7 * 24 * time.Hour,
+				LeafDuration: 24 * time.Hour,
+				CRLDuration:  24 * time.Hour,
+				Clock:        fakeClock,
+			},
+		}}
+		req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: ns.Name, Name: "ca-cert"}}
+
+		reconcile := func() (*x509.Certificate, []*x509.Certificate) {
+			GinkgoHelper()
+			requeueAfter, err := r.reconcileSecret(ctx, req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requeueAfter).To(BeNumerically(">", 0))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, req.NamespacedName, secret)).To(Succeed())
+			caCert, err := pki.DecodeX509CertificateBytes(secret.Data[corev1.TLSCertKey])
+			Expect(err).ToNot(HaveOccurred())
+			caBundle, err := pki.DecodeX509CertificateSetBytes(secret.Data[TLSCABundleKey])
+			Expect(err).ToNot(HaveOccurred())
+			return caCert, caBundle
+		}
+
+		By("generating the first CA")
+		first, caBundle := reconcile()
+		Expect(caBundle).To(ConsistOf(first))
+
+		By("keeping the CA until 2/3 of its lifetime")
+		fakeClock.SetTime(first.NotBefore.Add(4 * 24 * time.Hour))
+		caCert, caBundle := reconcile()
+		Expect(caCert).To(Equal(first))
+		Expect(caBundle).To(ConsistOf(first))
+
+		By("rotating the CA in the first week, retaining the previous CA")
+		fakeClock.SetTime(first.NotBefore.Add(5 * 24 * time.Hour))
+		second, caBundle := reconcile()
+		Expect(second).ToNot(Equal(first))
+		Expect(caBundle).To(ConsistOf(first, second))
+
+		By("pruning the previous CA once expired")
+		fakeClock.SetTime(first.NotAfter.Add(time.Minute))
+		caCert, caBundle = reconcile()
+		Expect(caCert).To(Equal(second))
+		Expect(caBundle).To(ConsistOf(second))
+		Expect(recorder.Events).To(Receive(Equal("Normal CABundlePruned Pruned 1 CA certificates from the CA bundle: " + first.SerialNumber.Text(16))))
+
+		By("rotating the CA in the second week")
+		fakeClock.SetTime(second.NotBefore.Add(5 * 24 * time.Hour))
+		third, caBundle := reconcile()
+		Expect(third).ToNot(Equal(second))
+		Expect(caBundle).To(ConsistOf(second, third))
+
+		By("rotating the CA in the third week")
+		fakeClock.SetTime(third.NotBefore.Add(5 * 24 * time.Hour))
+		fourth, caBundle := reconcile()
+		Expect(fourth).ToNot(Equal(third))
+		Expect(caBundle).To(ConsistOf(third, fourth))
+	})
+})
+
+var _ = Describe("CA bundle retention", func() {
+	var (
+		fakeClock *clocktesting.FakePassiveClock
+		r         *CASecretReconciler
+		cas       []*x509.Certificate
+		caBundle  []byte
+	)
+
+	BeforeEach(func() {
+		fakeClock = clocktesting.NewFakePassiveClock(time.Now())
+		r = &CASecretReconciler{reconciler: reconciler{Opts: Options{
+			CADuration: 7 * 24 * time.Hour,
+			CABundle:   CABundleOptions{MaxCertificates: 3},
+			Clock:      fakeClock,
+		}}}
+
+		// Generate a CA every day, retaining all of them
+		cas = nil
+		caBundle = nil
+		for range 3 {
+			caCert, _, err := GenerateCA(r.Opts)
+			Expect(err).ToNot(HaveOccurred())
+			cas = append(cas, caCert)
+			caBundle, _, err = r.reconcileCABundle(caBundle, caCert)
+			Expect(err).ToNot(HaveOccurred())
+			fakeClock.SetTime(fakeClock.Now().Add(24 * time.Hour))
+		}
+	})
+
+	reconcile := func() ([]*x509.Certificate, []*x509.Certificate, *x509.Certificate) {
+		GinkgoHelper()
+		caCert, _, err := GenerateCA(r.Opts)
+		Expect(err).ToNot(HaveOccurred())
+		caBundleBytes, pruned, err := r.reconcileCABundle(caBundle, caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caBundle, err := pki.DecodeX509CertificateSetBytes(caBundleBytes)
+		Expect(err).ToNot(HaveOccurred())
+		return caBundle, pruned, caCert
+	}
+
+	It("should prune the oldest CAs exceeding the maximum", func() {
+		bundle, pruned, caCert := reconcile()
+		Expect(bundle).To(ConsistOf(cas[1], cas[2], caCert))
+		Expect(pruned).To(ConsistOf(cas[0]))
+	})
+
+	It("should retain expired CAs during the grace period", func() {
+		r.Opts.CABundle.MaxCertificates = 5
+		r.Opts.CABundle.ExpiryGracePeriod = time.Hour
+		fakeClock.SetTime(cas[0].NotAfter.Add(30 * time.Minute))
+		bundle, pruned, caCert := reconcile()
+		Expect(bundle).To(ConsistOf(cas[0], cas[1], cas[2], caCert))
+		Expect(pruned).To(BeEmpty())
+
+		fakeClock.SetTime(cas[0].NotAfter.Add(90 * time.Minute))
+		bundle, pruned, caCert = reconcile()
+		Expect(bundle).To(ConsistOf(cas[1], cas[2], caCert))
+		Expect(pruned).To(ConsistOf(cas[0]))
+	})
+
+	It("should order the CA bundle newest first", func() {
+		r.Opts.CABundle.NewestFirst = true
+		bundle, _, caCert := reconcile()
+		Expect(bundle).To(HaveExactElements(caCert, cas[2], cas[1]))
+	})
+})
+
+var _ = Describe("CA without CRL signing", func() {
+	It("should be kept until it is due for rotation, without publishing a CRL", func() {
+		fakeClock := clocktesting.NewFakePassiveClock(time.Now())
+		r := &CASecretReconciler{reconciler: reconciler{Opts: Options{
+			CADuration:   7 * 24 * time.Hour,
+			LeafDuration: 24 * time.Hour,
+			CRLDuration:  24 * time.Hour,
+			CABundle:     CABundleOptions{MaxCertificates: 3},
+			Clock:        fakeClock,
+		}}}
+
+		// A CA generated before revocation support
+		pk, err := pki.GenerateECPrivateKey(384)
+		Expect(err).ToNot(HaveOccurred())
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: "cert-manager-dynamic-ca"},
+			NotBefore:             fakeClock.Now(),
+			NotAfter:              fakeClock.Now().Add(r.Opts.CADuration),
+			KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+			BasicConstraintsValid: true,
+			IsCA:                  true,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, pk.Public(), pk)
+		Expect(err).ToNot(HaveOccurred())
+		caCert, err := x509.ParseCertificate(der)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		pkBytes, err := pki.EncodePrivateKey(pk)
+		Expect(err).ToNot(HaveOccurred())
+
+		secret := &corev1.Secret{}
+		secret.Data = map[string][]byte{
+			corev1.TLSCertKey:       caCertBytes,
+			corev1.TLSPrivateKeyKey: pkBytes,
+		}
+		generate, cert, _ := r.needsGenerate(secret)
+		Expect(generate).To(BeFalse())
+		Expect(cert).To(Equal(caCert))
+
+		data, _, requeueAfter, err := r.caSecretData(ctx, secret, caCert, pk)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).ToNot(HaveKey(TLSCRLKey))
+		Expect(requeueAfter).To(Equal(renewAfter(fakeClock, caCert)))
+
+		fakeClock.SetTime(caCert.NotBefore.Add(5 * 24 * time.Hour))
+		generate, _, _ = r.needsGenerate(secret)
+		Expect(generate).To(BeTrue())
+	})
 })
@@ -0,0 +1,113 @@
+package authority
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// certDataDir is the symlink pointing to the current version of the
+	// certificate files, following the layout used by the kubelet for
+	// Secret volumes.
+	certDataDir    = "..data"
+	certDataDirTmp = "..data_tmp"
+)
+
+// certificateFileWriter atomically writes certificate files to a directory.
+//
+// Each version of the files is written to a new, timestamped directory.
+// A "..data" symlink to the current version is then atomically replaced by
+// a rename, and the files in the directory are symlinks into "..data".
+// Readers will therefore always observe a consistent set of files, and
+// file watchers like controller-runtime's certwatcher or Envoy's SDS
+// watched_directory are notified by the rename.
+type certificateFileWriter struct {
+	dir  string
+	mode os.FileMode
+}
+
+func (w certificateFileWriter) write(files map[string][]byte) error {
+	if err := os.MkdirAll(w.dir, 0o755); err != nil {
+		return err
+	}
+
+	oldVersionDir, err := os.Readlink(filepath.Join(w.dir, certDataDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	versionDir, err := os.MkdirTemp(w.dir, time.Now().UTC().Format("..2006_01_02_15_04_05."))
+	if err != nil {
+		return err
+	}
+	// Remove the new version unless it becomes the current version
+	published := false
+	defer func() {
+		if !published {
+			_ = os.RemoveAll(versionDir)
+		}
+	}()
+	if err := os.Chmod(versionDir, 0o755); err != nil {
+		return err
+	}
+	for name, data := range files {
+		if err := w.writeFile(filepath.Join(versionDir, name), data); err != nil {
+			return err
+		}
+	}
+
+	dataDirTmp := filepath.Join(w.dir, certDataDirTmp)
+	if err := os.Remove(dataDirTmp); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Symlink(filepath.Base(versionDir), dataDirTmp); err != nil {
+		return err
+	}
+	if err := os.Rename(dataDirTmp, filepath.Join(w.dir, certDataDir)); err != nil {
+		return err
+	}
+	published = true
+
+	for name := range files {
+		link := filepath.Join(w.dir, name)
+		target := filepath.Join(certDataDir, name)
+		if current, err := os.Readlink(link); err == nil && current == target {
+			continue
+		}
+		if err := os.Remove(link); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err := os.Symlink(target, link); err != nil {
+			return err
+		}
+	}
+
+	if oldVersionDir != "" && strings.HasPrefix(oldVersionDir, "..") {
+		return os.RemoveAll(filepath.Join(w.dir, oldVersionDir))
+	}
+	return nil
+}
+
+func (w certificateFileWriter) writeFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, w.mode)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed writing %s: %w", name, err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// Make the file mode independent of the process umask
+	return os.Chmod(name, w.mode)
+}
@@ -0,0 +1,60 @@
+package authority
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Certificate File Writer", func() {
+	var (
+		dir    string
+		writer certificateFileWriter
+	)
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+		writer = certificateFileWriter{dir: dir, mode: 0o640}
+	})
+
+	readFile := func(name string) (string, error) {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		return string(data), err
+	}
+
+	It("should write files with the configured mode", func() {
+		Expect(writer.write(map[string][]byte{"tls.crt": []byte("cert"), "tls.key": []byte("key")})).To(Succeed())
+
+		Expect(readFile("tls.crt")).To(Equal("cert"))
+		Expect(readFile("tls.key")).To(Equal("key"))
+
+		info, err := os.Stat(filepath.Join(dir, "tls.key"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o640)))
+	})
+
+	It("should replace files and remove the previous version", func() {
+		Expect(writer.write(map[string][]byte{"tls.crt": []byte("cert1")})).To(Succeed())
+		oldVersionDir, err := os.Readlink(filepath.Join(dir, certDataDir))
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(writer.write(map[string][]byte{"tls.crt": []byte("cert2")})).To(Succeed())
+		Expect(readFile("tls.crt")).To(Equal("cert2"))
+		Expect(filepath.Join(dir, oldVersionDir)).ToNot(BeADirectory())
+
+		entries, err := os.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(3))
+	})
+	It("should remove the new version if writing fails", func() {
+		Expect(writer.write(map[string][]byte{"tls.crt": []byte("cert1")})).To(Succeed())
+
+		Expect(writer.write(map[string][]byte{"missing/tls.crt": []byte("cert2")})).ToNot(Succeed())
+		Expect(readFile("tls.crt")).To(Equal("cert1"))
+		entries, err := os.ReadDir(dir)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(HaveLen(3))
+	})
+})
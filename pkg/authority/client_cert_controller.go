@@ -0,0 +1,97 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	pkierrors "github.com/erikgb/dynamic-authority/internal/pki/errors"
+)
+
+// ClientCertReconciler reconciles the client certificate
+type ClientCertReconciler struct {
+	reconciler
+	certificateHolder *CertificateHolder
+	// The certificate last issued, reused until it is due for renewal
+	issued *issuedCertificates
+}
+
+// +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClientCertReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("cert_client").
+		WatchesRawSource(r.caSecretSource(&handler.TypedEnqueueRequestForObject[*corev1.Secret]{})).
+		// Disable leader election since all replicas need a client certificate
+		WithOptions(controller.TypedOptions[ctrl.Request]{NeedLeaderElection: ptr.To(false)}).
+		Complete(r)
+}
+
+func (r *ClientCertReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	requeueAfter, err := r.reconcileSecret(ctx, req)
+	return ctrl.Result{RequeueAfter: requeueAfter}, r.handleError(newSecret(req.NamespacedName), err)
+}
+
+func (r *ClientCertReconciler) reconcileSecret(ctx context.Context, req ctrl.Request) (time.Duration, error) {
+	caSecret := &corev1.Secret{}
+	if err := r.Get(ctx, req.NamespacedName, caSecret); err != nil {
+		if errors.IsNotFound(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	caCertBytes := caSecret.Data[corev1.TLSCertKey]
+	caPkBytes := caSecret.Data[corev1.TLSPrivateKeyKey]
+	revoked, err := revokedCertificates(caSecret.Data[TLSCRLKey])
+	if err != nil {
+		return 0, pkierrors.NewInvalidData("failed decoding CRL: %v", err)
+	}
+
+	issued := r.issued
+	if issued == nil || !bytes.Equal(issued.caCertData, caCertBytes) || renewAfter(r.Opts.clock(), issued.cert.Leaf) <= 0 || issued.revoked(revoked) {
+		if issued, err = r.issueCertificate(ctx, caCertBytes, caPkBytes); err != nil {
+			return 0, err
+		}
+		r.issued = issued
+	}
+
+	r.certificateHolder.SetCertificate(issued.cert)
+
+	return renewAfter(r.Opts.clock(), issued.cert.Leaf), nil
+}
+
+func (r *ClientCertReconciler) issueCertificate(ctx context.Context, caCertBytes, caPkBytes []byte) (*issuedCertificates, error) {
+	template := &x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   r.Opts.ClientCertificate.CommonName,
+			Organization: r.Opts.ClientCertificate.Organization,
+		},
+	}
+	certData, pkData, err := r.issueLeaf(ctx, ClientProfile(), template, x509.ECDSA, caCertBytes, caPkBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCert, err := newTLSCertificate(certData, pkData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &issuedCertificates{
+		caCertData: caCertBytes,
+		certData:   certData,
+		pkData:     pkData,
+		cert:       tlsCert,
+	}, nil
+}
@@ -0,0 +1,183 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	clocktesting "k8s.io/utils/clock/testing"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+var _ = Describe("Client Cert Controller", Ordered, func() {
+	var (
+		caCert     *x509.Certificate
+		certHolder *CertificateHolder
+	)
+
+	BeforeAll(func() {
+		opts := Options{
+			Namespace:    "client-cert-controller",
+			CASecret:     "ca-cert",
+			CADuration:   7 * time.Hour,
+			LeafDuration: 3 * time.Second,
+			ClientCertificate: ClientCertificateOptions{
+				CommonName:   "operator",
+				Organization: []string{"cert-manager"},
+			},
+		}
+
+		ns := &corev1.Namespace{}
+		ns.Name = opts.Namespace
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		var (
+			caPK crypto.Signer
+			err  error
+		)
+		caCert, caPK, err = GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		pkBytes, err := pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		caSecret := &corev1.Secret{}
+		caSecret.Namespace = opts.Namespace
+		caSecret.Name = opts.CASecret
+		caSecret.Type = corev1.SecretTypeTLS
+		caSecret.Labels = map[string]string{
+			DynamicAuthoritySecretLabel: "true",
+		}
+		caSecret.Data = map[string][]byte{
+			corev1.TLSCertKey:       caCertBytes,
+			corev1.TLSPrivateKeyKey: pkBytes,
+		}
+		Expect(k8sClient.Create(ctx, caSecret)).To(Succeed())
+
+		k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme: scheme.Scheme,
+			Metrics: metricsserver.Options{
+				BindAddress: "0",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		certHolder = &CertificateHolder{}
+		controller := &ClientCertReconciler{
+			reconciler: reconciler{
+				Client: k8sManager.GetClient(),
+				Cache:  k8sManager.GetCache(),
+				Opts:   opts,
+			},
+			certificateHolder: certHolder,
+		}
+		Expect(controller.SetupWithManager(k8sManager)).To(Succeed())
+
+		go func() {
+			defer GinkgoRecover()
+			err = k8sManager.Start(ctx)
+			Expect(err).ToNot(HaveOccurred(), "failed to run manager")
+		}()
+	})
+
+	It("should set client certificate", func() {
+		Eventually(func() (*tls.Certificate, error) {
+			return certHolder.GetClientCertificate(nil)
+		}).Should(HaveField("Leaf", And(
+			HaveField("Subject.CommonName", Equal("operator")),
+			HaveField("Subject.Organization", ConsistOf("cert-manager")),
+			HaveField("ExtKeyUsage", ConsistOf(x509.ExtKeyUsageClientAuth)),
+			WithTransform(func(cert *x509.Certificate) error {
+				return cert.CheckSignatureFrom(caCert)
+			}, Succeed()),
+		)))
+	})
+
+	It("should renew client certificate", func() {
+		cert, err := certHolder.GetClientCertificate(nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		Eventually(func() (*tls.Certificate, error) {
+			return certHolder.GetClientCertificate(nil)
+		}).WithTimeout(5 * time.Second).ShouldNot(BeIdenticalTo(cert))
+	})
+})
+
+var _ = Describe("Client Cert Reconciler", func() {
+	It("should reuse the client certificate until it is due for renewal", func() {
+		fakeClock := clocktesting.NewFakePassiveClock(time.Now())
+		opts := Options{
+			Namespace:    "cert-manager",
+			CASecret:     "ca-cert",
+			CADuration:   7 * time.Hour,
+			LeafDuration: 1 * time.Hour,
+			ClientCertificate: ClientCertificateOptions{
+				CommonName: "operator",
+			},
+			Clock: fakeClock,
+		}
+		caCert, caPK, err := GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		pkBytes, err := pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		caSecret := newSecret(types.NamespacedName{Namespace: opts.Namespace, Name: opts.CASecret})
+		caSecret.Data = map[string][]byte{
+			corev1.TLSCertKey:       caCertBytes,
+			corev1.TLSPrivateKeyKey: pkBytes,
+		}
+		k8sClient := fake.NewClientBuilder().WithObjects(caSecret).Build()
+		certHolder := &CertificateHolder{}
+		r := &ClientCertReconciler{
+			reconciler: reconciler{
+				Client: k8sClient,
+				Opts:   opts,
+			},
+			certificateHolder: certHolder,
+		}
+		reconcile := func() *tls.Certificate {
+			_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(caSecret)})
+			Expect(err).ToNot(HaveOccurred())
+			cert, err := certHolder.GetClientCertificate(nil)
+			Expect(err).ToNot(HaveOccurred())
+			return cert
+		}
+
+		first := reconcile()
+
+		By("reusing the certificate")
+		fakeClock.SetTime(fakeClock.Now().Add(30 * time.Minute))
+		Expect(reconcile()).To(BeIdenticalTo(first))
+
+		By("reissuing the certificate when it is due for renewal")
+		fakeClock.SetTime(fakeClock.Now().Add(15 * time.Minute))
+		second := reconcile()
+		Expect(second.Leaf.Equal(first.Leaf)).To(BeFalse())
+
+		By("reissuing the certificate when the CA changed")
+		newCACert, newCAPK, err := GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caSecret.Data[corev1.TLSCertKey], err = pki.EncodeX509(newCACert)
+		Expect(err).ToNot(HaveOccurred())
+		caSecret.Data[corev1.TLSPrivateKeyKey], err = pki.EncodePrivateKey(newCAPK)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(k8sClient.Update(ctx, caSecret)).To(Succeed())
+		third := reconcile()
+		Expect(third.Leaf.CheckSignatureFrom(newCACert)).To(Succeed())
+	})
+})
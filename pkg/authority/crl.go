@@ -0,0 +1,199 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/utils/clock"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+// RevokeCertificate revokes the certificate with the given serial number,
+// issued by the dynamic CA stored in the referenced CA Secret, by adding it
+// to the RevokeCertificatesAnnotation of the Secret.
+func RevokeCertificate(ctx context.Context, c client.Client, caSecret types.NamespacedName, serialNumber *big.Int) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, caSecret, secret); err != nil {
+			return err
+		}
+
+		serials, err := revokedSerialNumbers(secret)
+		if err != nil {
+			return err
+		}
+		for _, s := range serials {
+			if s.Cmp(serialNumber) == 0 {
+				return nil
+			}
+		}
+
+		patch := client.MergeFromWithOptions(secret.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		annotations := secret.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		value := serialNumber.Text(16)
+		if v := annotations[RevokeCertificatesAnnotation]; v != "" {
+			value = v + "," + value
+		}
+		annotations[RevokeCertificatesAnnotation] = value
+		secret.SetAnnotations(annotations)
+
+		return c.Patch(ctx, secret, patch)
+	})
+}
+
+// revokedSerialNumbers returns the serial numbers listed in the
+// RevokeCertificatesAnnotation of the CA Secret.
+func revokedSerialNumbers(secret *corev1.Secret) ([]*big.Int, error) {
+	var serials []*big.Int
+	for _, s := range strings.Split(secret.Annotations[RevokeCertificatesAnnotation], ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		serial, ok := new(big.Int).SetString(strings.TrimPrefix(strings.ToLower(s), "0x"), 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid serial number %q in annotation %s", s, RevokeCertificatesAnnotation)
+		}
+		serials = append(serials, serial)
+	}
+	return serials, nil
+}
+
+// generateCRL returns the PEM encoded CRL of the CA, and when it should be
+// regenerated. The current CRL is returned unchanged if it is signed by the
+// CA, lists the revoked certificates and is not due for renewal.
+//
+// Certificates listed in the RevokeCertificatesAnnotation are kept in the
+// CRL. Certificates no longer listed are kept until they would have expired.
+// The CRL is only authoritative for certificates issued by the CA, so
+// certificates issued by previous CAs are left out after a rotation.
+func generateCRL(opts Options, secret *corev1.Secret, caCert *x509.Certificate, caPk crypto.Signer) ([]byte, time.Duration, error) {
+	serials, err := revokedSerialNumbers(secret)
+	if err != nil {
+		return nil, 0, err
+	}
+	key, err := serialNumberKey(caPk)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := opts.clock().Now()
+	current, _ := pki.DecodeX509RevocationListBytes(secret.Data[TLSCRLKey])
+
+	revokedAt := map[string]time.Time{}
+	if current != nil {
+		for _, entry := range current.RevokedCertificateEntries {
+			revokedAt[entry.SerialNumber.String()] = entry.RevocationTime
+		}
+	}
+
+	var entries []x509.RevocationListEntry
+	listed := map[string]bool{}
+	for _, serial := range serials {
+		if listed[serial.String()] || !issuedSerialNumber(key, serial) {
+			continue
+		}
+		listed[serial.String()] = true
+		t, ok := revokedAt[serial.String()]
+		if !ok {
+			t = now.Truncate(time.Second)
+		}
+		entries = append(entries, x509.RevocationListEntry{SerialNumber: serial, RevocationTime: t})
+	}
+	if current != nil {
+		for _, entry := range current.RevokedCertificateEntries {
+			if listed[entry.SerialNumber.String()] || !issuedSerialNumber(key, entry.SerialNumber) || entry.RevocationTime.Add(opts.LeafDuration).Before(now) {
+				continue
+			}
+			listed[entry.SerialNumber.String()] = true
+			entries = append(entries, x509.RevocationListEntry{SerialNumber: entry.SerialNumber, RevocationTime: entry.RevocationTime})
+		}
+	}
+	slices.SortFunc(entries, func(a, b x509.RevocationListEntry) int {
+		return a.SerialNumber.Cmp(b.SerialNumber)
+	})
+
+	if current != nil && current.CheckSignatureFrom(caCert) == nil && sameEntries(current, entries) {
+		if requeueAfter := crlRenewAfter(opts.clock(), current); requeueAfter > 0 {
+			return secret.Data[TLSCRLKey], requeueAfter, nil
+		}
+	}
+
+	number := big.NewInt(1)
+	if current != nil && current.Number != nil {
+		number.Add(current.Number, number)
+	}
+
+	template := &x509.RevocationList{
+		Number:                    number,
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(opts.CRLDuration),
+		RevokedCertificateEntries: entries,
+	}
+	crlDER, err := x509.CreateRevocationList(rand.Reader, template, caCert, caPk)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed creating CRL: %w", err)
+	}
+	crl, err := x509.ParseRevocationList(crlDER)
+	if err != nil {
+		return nil, 0, err
+	}
+	crlBytes, err := pki.EncodeX509RevocationList(crl)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return crlBytes, crlRenewAfter(opts.clock(), crl), nil
+}
+
+// sameEntries returns true if the CRL lists exactly the given entries.
+func sameEntries(crl *x509.RevocationList, entries []x509.RevocationListEntry) bool {
+	if len(crl.RevokedCertificateEntries) != len(entries) {
+		return false
+	}
+	for i, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(entries[i].SerialNumber) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// crlRenewAfter returns the duration until the given CRL should be
+// regenerated, which is after 2/3 of its validity.
+func crlRenewAfter(clock clock.PassiveClock, crl *x509.RevocationList) time.Duration {
+	validity := crl.NextUpdate.Sub(crl.ThisUpdate)
+	return crl.ThisUpdate.Add(validity * 2 / 3).Sub(clock.Now())
+}
+
+// revokedCertificates returns the revocation time of the certificates listed
+// in a PEM encoded CRL, by serial number.
+func revokedCertificates(crlBytes []byte) (map[string]time.Time, error) {
+	if len(crlBytes) == 0 {
+		return nil, nil
+	}
+	crl, err := pki.DecodeX509RevocationListBytes(crlBytes)
+	if err != nil {
+		return nil, err
+	}
+	revoked := make(map[string]time.Time, len(crl.RevokedCertificateEntries))
+	for _, entry := range crl.RevokedCertificateEntries {
+		revoked[entry.SerialNumber.String()] = entry.RevocationTime
+	}
+	return revoked, nil
+}
@@ -0,0 +1,120 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/x509"
+	"math/big"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+var _ = Describe("CRL", func() {
+	var (
+		opts   Options
+		caCert *x509.Certificate
+		caPK   crypto.Signer
+		secret *corev1.Secret
+	)
+
+	BeforeEach(func() {
+		opts = Options{CADuration: time.Hour, LeafDuration: time.Hour, CRLDuration: time.Hour}
+		var err error
+		caCert, caPK, err = GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		secret = &corev1.Secret{Data: map[string][]byte{}}
+	})
+
+	generate := func() (*x509.RevocationList, time.Duration) {
+		crlBytes, requeueAfter, err := generateCRL(opts, secret, caCert, caPK)
+		Expect(err).ToNot(HaveOccurred())
+		secret.Data[TLSCRLKey] = crlBytes
+		crl, err := pki.DecodeX509RevocationListBytes(crlBytes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(crl.CheckSignatureFrom(caCert)).To(Succeed())
+		return crl, requeueAfter
+	}
+
+	// issued returns a hex encoded serial number issued by the CA
+	issued := func() string {
+		serialNumber, err := newSerialNumber(caPK)
+		Expect(err).ToNot(HaveOccurred())
+		return serialNumber.Text(16)
+	}
+
+	serials := func(crl *x509.RevocationList) []string {
+		var s []string
+		for _, entry := range crl.RevokedCertificateEntries {
+			s = append(s, entry.SerialNumber.Text(16))
+		}
+		return s
+	}
+
+	It("should generate empty CRL", func() {
+		crl, requeueAfter := generate()
+		Expect(crl.RevokedCertificateEntries).To(BeEmpty())
+		Expect(crl.Number).To(Equal(big.NewInt(1)))
+		Expect(crl.NextUpdate.Sub(crl.ThisUpdate)).To(Equal(time.Hour))
+		Expect(requeueAfter).To(BeNumerically("~", 40*time.Minute, time.Minute))
+	})
+
+	It("should only regenerate CRL if changed", func() {
+		crl, _ := generate()
+		crlBytes := secret.Data[TLSCRLKey]
+
+		generate()
+		Expect(secret.Data[TLSCRLKey]).To(Equal(crlBytes))
+
+		a, b := issued(), issued()
+		secret.Annotations = map[string]string{RevokeCertificatesAnnotation: "0x" + a + ", " + strings.ToUpper(b)}
+		updated, _ := generate()
+		Expect(updated.Number).To(Equal(big.NewInt(2)))
+		Expect(updated.ThisUpdate).ToNot(BeTemporally("<", crl.ThisUpdate))
+		Expect(serials(updated)).To(ConsistOf(a, b))
+	})
+
+	It("should keep revoked certificates until expired", func() {
+		a, b := issued(), issued()
+		secret.Annotations = map[string]string{RevokeCertificatesAnnotation: a + "," + b}
+		crl, _ := generate()
+		Expect(serials(crl)).To(ConsistOf(a, b))
+
+		By("removing a serial number from the annotation")
+		secret.Annotations[RevokeCertificatesAnnotation] = a
+		crl, _ = generate()
+		Expect(serials(crl)).To(ConsistOf(a, b))
+
+		By("expiring the certificates")
+		opts.LeafDuration = time.Nanosecond
+		crl, _ = generate()
+		Expect(serials(crl)).To(ConsistOf(a))
+	})
+
+	It("should only list certificates issued by the CA", func() {
+		a := issued()
+		secret.Annotations = map[string]string{RevokeCertificatesAnnotation: a + ",c0ffee"}
+		crl, _ := generate()
+		Expect(serials(crl)).To(ConsistOf(a))
+
+		By("rotating the CA")
+		var err error
+		caCert, caPK, err = GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		b := issued()
+		secret.Annotations[RevokeCertificatesAnnotation] = a + "," + b
+		crl, _ = generate()
+		Expect(serials(crl)).To(ConsistOf(b))
+	})
+
+	It("should refuse invalid serial numbers", func() {
+		secret.Annotations = map[string]string{RevokeCertificatesAnnotation: "a,foo"}
+		_, _, err := generateCRL(opts, secret, caCert, caPK)
+		Expect(err).To(MatchError(ContainSubstring(`invalid serial number "foo"`)))
+	})
+})
@@ -0,0 +1,61 @@
+package authority
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	pkierrors "github.com/erikgb/dynamic-authority/internal/pki/errors"
+)
+
+var (
+	// ErrInvalidData is returned when certificate, key or CRL data, e.g. in
+	// the CA Secret, can't be decoded. Use errors.As with an
+	// *InvalidDataError for details.
+	ErrInvalidData = pkierrors.ErrInvalidData
+	// ErrKeyMismatch is returned when a private key does not match the
+	// public key of its certificate.
+	ErrKeyMismatch = errors.New("private key does not match certificate")
+	// ErrCAExpired is returned when signing with an expired CA certificate.
+	// The CA is rotated by the dynamic authority, so signing can be retried.
+	ErrCAExpired = errors.New("CA certificate has expired")
+	// ErrPolicyViolation is returned when a certificate signing request is
+	// refused by the CSRPolicy, see SignCSR.
+	ErrPolicyViolation = pkierrors.ErrPolicyViolation
+	// ErrLintFailed is returned when a certificate is not published, as it
+	// has lint findings of error severity, see LintOptions.
+	ErrLintFailed = pkierrors.ErrLintFailed
+	// ErrInjectionRefused is returned when the CA bundle is not injected into
+	// an injectable. Use errors.As with an *InjectionError for details.
+	ErrInjectionRefused = errors.New("CA injection refused")
+)
+
+// InvalidDataError is returned when certificate, key or CRL data can't be
+// decoded or is otherwise invalid. It matches ErrInvalidData.
+type InvalidDataError = pkierrors.InvalidDataError
+
+// InjectionError is returned when the CA bundle can't be injected into an
+// injectable. It matches ErrInjectionRefused.
+type InjectionError struct {
+	// The kind and namespaced name of the injectable.
+	GroupVersionKind schema.GroupVersionKind
+	Object           types.NamespacedName
+
+	Err error
+}
+
+func (e *InjectionError) Error() string {
+	return fmt.Sprintf("failed injecting CA into %s %s: %v", e.GroupVersionKind.Kind, e.Object, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *InjectionError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrInjectionRefused.
+func (e *InjectionError) Is(target error) bool {
+	return target == ErrInjectionRefused
+}
@@ -0,0 +1,126 @@
+package authority
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	clocktesting "k8s.io/utils/clock/testing"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+	pkierrors "github.com/erikgb/dynamic-authority/internal/pki/errors"
+)
+
+var _ = Describe("Errors", func() {
+	Context("Sign", func() {
+		var (
+			opts        Options
+			fakeClock   *clocktesting.FakePassiveClock
+			caCert      *x509.Certificate
+			caCertBytes []byte
+			caPkBytes   []byte
+		)
+
+		generate := func() (*x509.Certificate, []byte, []byte) {
+			cert, pk, err := GenerateCA(opts)
+			Expect(err).ToNot(HaveOccurred())
+			certBytes, err := pki.EncodeX509(cert)
+			Expect(err).ToNot(HaveOccurred())
+			pkBytes, err := pki.EncodePrivateKey(pk)
+			Expect(err).ToNot(HaveOccurred())
+			return cert, certBytes, pkBytes
+		}
+
+		BeforeEach(func() {
+			fakeClock = clocktesting.NewFakePassiveClock(time.Now())
+			opts = Options{CADuration: time.Hour, LeafDuration: time.Minute, Clock: fakeClock}
+			caCert, caCertBytes, caPkBytes = generate()
+		})
+
+		sign := func(certBytes, pkBytes []byte) error {
+			pk, err := pki.GenerateECPrivateKey(pki.ECCurve256)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = Sign(opts, &x509.Certificate{PublicKey: pk.Public()}, certBytes, pkBytes)
+			return err
+		}
+
+		It("should return invalid data errors", func() {
+			err := sign([]byte("not a certificate"), caPkBytes)
+			Expect(err).To(MatchError(ErrInvalidData))
+			var invalidData *InvalidDataError
+			Expect(errors.As(err, &invalidData)).To(BeTrue())
+		})
+
+		It("should return key mismatch errors", func() {
+			_, _, otherPkBytes := generate()
+			Expect(sign(caCertBytes, otherPkBytes)).To(MatchError(ErrKeyMismatch))
+		})
+
+		It("should return CA expired errors", func() {
+			fakeClock.SetTime(caCert.NotAfter.Add(time.Second))
+			Expect(sign(caCertBytes, caPkBytes)).To(MatchError(ErrCAExpired))
+		})
+	})
+
+	It("should match injection errors to ErrInjectionRefused", func() {
+		err := fmt.Errorf("reconciling injectable: %w", &InjectionError{
+			GroupVersionKind: (&ValidatingWebhookCaBundleInject{}).GroupVersionKind(),
+			Object:           types.NamespacedName{Name: "webhook"},
+			Err:              errors.New("webhooks is not a list"),
+		})
+		Expect(err).To(MatchError(ErrInjectionRefused))
+		Expect(err).ToNot(MatchError(ErrInvalidData))
+		var injectionErr *InjectionError
+		Expect(errors.As(err, &injectionErr)).To(BeTrue())
+		Expect(injectionErr.Object.Name).To(Equal("webhook"))
+	})
+
+	Context("handleError", func() {
+		var (
+			recorder *record.FakeRecorder
+			r        reconciler
+			obj      = newSecret(types.NamespacedName{Namespace: "cert-manager", Name: "ca-cert"})
+		)
+
+		BeforeEach(func() {
+			recorder = record.NewFakeRecorder(10)
+			r = reconciler{Recorder: recorder}
+		})
+
+		DescribeTable("should record an event and quarantine",
+			func(err error, reason string) {
+				handled := r.handleError(obj, err)
+				Expect(handled).To(MatchError(reconcile.TerminalError(nil)))
+				Expect(handled).To(MatchError(err))
+				Expect(recorder.Events).To(Receive(HavePrefix("Warning " + reason)))
+			},
+			Entry("invalid data", pkierrors.NewInvalidData("error decoding certificate PEM block"), "InvalidData"),
+			Entry("key mismatch", ErrKeyMismatch, "KeyMismatch"),
+			Entry("injection refused", &InjectionError{
+				GroupVersionKind: (&ValidatingWebhookCaBundleInject{}).GroupVersionKind(),
+				Object:           types.NamespacedName{Name: "webhook"},
+				Err:              errors.New("webhooks is not a list"),
+			}, "InjectionRefused"),
+		)
+
+		It("should record an event and retry when the CA expired", func() {
+			handled := r.handleError(obj, ErrCAExpired)
+			Expect(handled).ToNot(MatchError(reconcile.TerminalError(nil)))
+			Expect(handled).To(MatchError(ErrCAExpired))
+			Expect(recorder.Events).To(Receive(HavePrefix("Warning CAExpired")))
+		})
+
+		It("should retry other errors", func() {
+			err := errors.New("connection refused")
+			Expect(r.handleError(obj, err)).To(BeIdenticalTo(err))
+			Expect(r.handleError(obj, nil)).To(Succeed())
+			Expect(recorder.Events).ToNot(Receive())
+		})
+	})
+})
@@ -0,0 +1,95 @@
+// Package grpccredentials provides gRPC transport credentials backed by the
+// dynamic authority.
+package grpccredentials
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"google.golang.org/grpc/credentials"
+
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+// NewServerCredentials returns TransportCredentials for gRPC servers, serving
+// the certificate maintained by the operator. Rotated certificates are used
+// for new connections, without restarting the grpc.Server.
+// Additional tls.Config options, e.g. operator.VerifyClientCertificate(), can
+// be passed to require mutual TLS.
+// It must be called before the operator is set up with the manager.
+func NewServerCredentials(operator *authority.ServingCertificateOperator, opts ...func(*tls.Config)) credentials.TransportCredentials {
+	config := newTLSConfig()
+	operator.ServingCertificate()(config)
+	for _, opt := range opts {
+		opt(config)
+	}
+	return credentials.NewTLS(config)
+}
+
+// NewClientCredentials returns TransportCredentials for gRPC clients,
+// verifying the server certificate against the current dynamic CA bundle.
+// The CA bundle is refreshed on rotation, for new connections. The server
+// certificate is verified against the host of the authority dialled, which
+// may be an IP address, unless a ServerName is set by an option.
+// Additional tls.Config options, e.g. operator.ClientCertificate(), can be
+// passed to authenticate using mutual TLS.
+// It must be called before the operator is set up with the manager.
+func NewClientCredentials(operator *authority.ServingCertificateOperator, opts ...func(*tls.Config)) credentials.TransportCredentials {
+	config := newTLSConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+	return &clientCredentials{
+		TransportCredentials:    credentials.NewTLS(config),
+		config:                  config,
+		verifyServerCertificate: operator.VerifyServerCertificate(),
+	}
+}
+
+// clientCredentials sets the server name of each connection before
+// verifying the server certificate against it, as the dynamic CA bundle is
+// verified by tls.Config.VerifyConnection, which doesn't know the IP address
+// dialled.
+type clientCredentials struct {
+	credentials.TransportCredentials
+	config                  *tls.Config
+	verifyServerCertificate func(*tls.Config)
+}
+
+func (c *clientCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	config := c.config.Clone()
+	if config.ServerName == "" {
+		host, _, err := net.SplitHostPort(authority)
+		if err != nil {
+			host = authority
+		}
+		config.ServerName = host
+	}
+	c.verifyServerCertificate(config)
+	return credentials.NewTLS(config).ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *clientCredentials) Clone() credentials.TransportCredentials {
+	return &clientCredentials{
+		TransportCredentials:    c.TransportCredentials.Clone(),
+		config:                  c.config.Clone(),
+		verifyServerCertificate: c.verifyServerCertificate,
+	}
+}
+
+// OverrideServerName sets the server name the server certificate is verified
+// against.
+func (c *clientCredentials) OverrideServerName(serverName string) error {
+	c.config.ServerName = serverName
+	return nil
+}
+
+func newTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Set here, as credentials.NewTLS only adds it to a copy of the
+		// config, which GetConfigForClient options don't see
+		NextProtos: []string{"h2"},
+	}
+}
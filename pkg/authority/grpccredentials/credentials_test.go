@@ -0,0 +1,130 @@
+package grpccredentials
+
+import (
+	"crypto/x509"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/peer"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/envtest/komega"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+	"github.com/erikgb/dynamic-authority/pkg/authority"
+)
+
+var _ = Describe("gRPC Credentials", Ordered, func() {
+	var (
+		caSecret    *corev1.Secret
+		address     string
+		clientCreds credentials.TransportCredentials
+	)
+
+	BeforeAll(func() {
+		ns := &corev1.Namespace{}
+		ns.Name = "grpc-credentials"
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		operator := &authority.ServingCertificateOperator{
+			Options: authority.Options{
+				Namespace:   ns.Name,
+				CASecret:    "ca-cert",
+				DNSNames:    []string{"localhost"},
+				IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+			},
+		}
+		serverCreds := NewServerCredentials(operator, operator.VerifyClientCertificate())
+		clientCreds = NewClientCredentials(operator, operator.ClientCertificate())
+
+		caSecret = &corev1.Secret{}
+		caSecret.Namespace = operator.Options.Namespace
+		caSecret.Name = operator.Options.CASecret
+
+		k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme: scheme.Scheme,
+			Metrics: metricsserver.Options{
+				BindAddress: "0",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(operator.SetupWithManager(k8sManager)).To(Succeed())
+
+		go func() {
+			defer GinkgoRecover()
+			err = k8sManager.Start(ctx)
+			Expect(err).ToNot(HaveOccurred(), "failed to run manager")
+		}()
+
+		server := grpc.NewServer(grpc.Creds(serverCreds))
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).ToNot(HaveOccurred())
+		address = lis.Addr().String()
+		go func() {
+			defer GinkgoRecover()
+			Expect(server.Serve(lis)).To(Succeed())
+		}()
+		DeferCleanup(server.Stop)
+	})
+
+	dial := func() *grpc.ClientConn {
+		conn, err := grpc.NewClient(address, grpc.WithTransportCredentials(clientCreds))
+		Expect(err).ToNot(HaveOccurred())
+		return conn
+	}
+
+	// check calls the health service, returning the server certificate
+	check := func(conn *grpc.ClientConn) (*x509.Certificate, error) {
+		var p peer.Peer
+		_, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Peer(&p))
+		if err != nil {
+			return nil, err
+		}
+		return p.AuthInfo.(credentials.TLSInfo).State.PeerCertificates[0], nil
+	}
+
+	signedByCA := func() OmegaMatcher {
+		Expect(komega.Get(caSecret)()).To(Succeed())
+		caCert, err := pki.DecodeX509CertificateBytes(caSecret.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		return WithTransform(func(cert *x509.Certificate) error {
+			return cert.CheckSignatureFrom(caCert)
+		}, Succeed())
+	}
+
+	It("should serve over mutual TLS across CA renewal", func() {
+		conn := dial()
+		DeferCleanup(conn.Close)
+		Eventually(func() (*x509.Certificate, error) {
+			return check(conn)
+		}).WithTimeout(30 * time.Second).Should(signedByCA())
+		caCertBytes := caSecret.Data[corev1.TLSCertKey]
+
+		By("forcing a CA renewal")
+		caSecret.Annotations = map[string]string{authority.RenewCertificateSecretAnnotation: time.Now().String()}
+		Expect(k8sClient.Update(ctx, caSecret)).To(Succeed())
+		Eventually(komega.Object(caSecret)).Should(
+			HaveField("Data", HaveKeyWithValue(corev1.TLSCertKey, Not(Equal(caCertBytes)))),
+		)
+
+		By("checking new connections use the renewed certificate")
+		Eventually(func() (*x509.Certificate, error) {
+			newConn := dial()
+			defer newConn.Close()
+			return check(newConn)
+		}).Should(signedByCA())
+
+		By("checking existing connections keep working")
+		Expect(check(conn)).ToNot(BeNil())
+	})
+})
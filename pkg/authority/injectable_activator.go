@@ -0,0 +1,107 @@
+package authority
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// injectableActivator sets up the controllers of injectables once their
+// kinds are served by the API server. Kinds are discovered by polling the
+// RESTMapper, which reloads the discovery information of unknown groups.
+type injectableActivator struct {
+	mapper   meta.RESTMapper
+	setup    func(Injectable) error
+	interval time.Duration
+
+	mu       sync.Mutex
+	inactive []Injectable
+}
+
+var _ manager.Runnable = &injectableActivator{}
+var _ manager.LeaderElectionRunnable = &injectableActivator{}
+
+// add sets up the controllers of the injectables with kinds that are served,
+// and keeps the others inactive until they are.
+func (a *injectableActivator) add(injectables []Injectable) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for _, injectable := range injectables {
+		if !a.served(injectable) {
+			a.inactive = append(a.inactive, injectable)
+			continue
+		}
+		if err := a.setup(injectable); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable. Controllers
+// are set up on all replicas, and started once elected.
+func (a *injectableActivator) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+func (a *injectableActivator) Start(ctx context.Context) error {
+	log := log.FromContext(ctx).WithName("injectable-activator")
+	log.Info("Waiting for injectable kinds to be served", "kinds", a.InactiveInjectables())
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		a.activate(ctx)
+	}, a.interval)
+	return nil
+}
+
+// activate sets up the controllers of inactive injectables with kinds that
+// are now served.
+func (a *injectableActivator) activate(ctx context.Context) {
+	log := log.FromContext(ctx)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	inactive := a.inactive[:0]
+	for _, injectable := range a.inactive {
+		gvk := injectable.GroupVersionKind()
+		if !a.served(injectable) {
+			inactive = append(inactive, injectable)
+			continue
+		}
+		if err := a.setup(injectable); err != nil {
+			log.Error(err, "when setting up injectable controller", "kind", gvk)
+			inactive = append(inactive, injectable)
+			continue
+		}
+		log.Info("Activated injectable", "kind", gvk)
+	}
+	a.inactive = inactive
+}
+
+func (a *injectableActivator) served(injectable Injectable) bool {
+	gvk := injectable.GroupVersionKind()
+	_, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	return err == nil
+}
+
+// InactiveInjectables returns the kinds of the injectables that are not
+// served yet.
+func (a *injectableActivator) InactiveInjectables() []schema.GroupVersionKind {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	gvks := make([]schema.GroupVersionKind, 0, len(a.inactive))
+	for _, injectable := range a.inactive {
+		gvks = append(gvks, injectable.GroupVersionKind())
+	}
+	return gvks
+}
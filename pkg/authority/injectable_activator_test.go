@@ -0,0 +1,64 @@
+package authority
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var _ = Describe("Injectable Activator", func() {
+	var (
+		mapper    *meta.DefaultRESTMapper
+		activator *injectableActivator
+		setup     []schema.GroupVersionKind
+		setupErr  error
+		vwc       = &ValidatingWebhookCaBundleInject{}
+	)
+
+	BeforeEach(func() {
+		mapper = meta.NewDefaultRESTMapper(nil)
+		setup = nil
+		setupErr = nil
+		activator = &injectableActivator{
+			mapper: mapper,
+			setup: func(injectable Injectable) error {
+				if setupErr != nil {
+					return setupErr
+				}
+				setup = append(setup, injectable.GroupVersionKind())
+				return nil
+			},
+		}
+	})
+
+	It("should set up controllers of served kinds", func() {
+		mapper.Add(vwc.GroupVersionKind(), meta.RESTScopeRoot)
+
+		Expect(activator.add([]Injectable{vwc})).To(Succeed())
+		Expect(setup).To(ConsistOf(vwc.GroupVersionKind()))
+		Expect(activator.InactiveInjectables()).To(BeEmpty())
+	})
+
+	It("should set up controllers once kinds are served", func() {
+		Expect(activator.add([]Injectable{vwc})).To(Succeed())
+		Expect(setup).To(BeEmpty())
+		Expect(activator.InactiveInjectables()).To(ConsistOf(vwc.GroupVersionKind()))
+
+		activator.activate(ctx)
+		Expect(setup).To(BeEmpty())
+
+		mapper.Add(vwc.GroupVersionKind(), meta.RESTScopeRoot)
+		setupErr = errors.New("boom")
+		activator.activate(ctx)
+		Expect(activator.InactiveInjectables()).To(ConsistOf(vwc.GroupVersionKind()))
+
+		setupErr = nil
+		activator.activate(ctx)
+		Expect(setup).To(ConsistOf(vwc.GroupVersionKind()))
+		Expect(activator.InactiveInjectables()).To(BeEmpty())
+	})
+})
@@ -2,14 +2,18 @@ package authority
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"strings"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
@@ -23,9 +27,37 @@ type InjectableReconciler struct {
 	Injectable Injectable
 }
 
+// injectFromSecretIndex is the cache index of injectables by the namespaced
+// name of the Secret they want injection from.
+const injectFromSecretIndex = "injectFromSecret"
+
+// +kubebuilder:rbac:groups="",resources=namespaces,verbs=list;watch
+
 // SetupWithManager sets up the controllers with the Manager.
 func (r *InjectableReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	if err := r.Cache.IndexField(context.TODO(), newUnstructured(r.Injectable), injectFromSecretIndex, r.injectFromSecrets); err != nil {
+		return err
+	}
+
+	caSecretRef := types.NamespacedName{Namespace: r.Opts.Namespace, Name: r.Opts.CASecret}.String()
+	b := ctrl.NewControllerManagedBy(mgr)
+	if r.Opts.InjectableNamespaceSelector != nil {
+		namespaced, err := apiutil.IsObjectNamespaced(newUnstructured(r.Injectable), mgr.GetScheme(), mgr.GetRESTMapper())
+		if err != nil {
+			return err
+		}
+		if namespaced {
+			// Inject the injectables in a namespace once it is selected
+			b = b.WatchesRawSource(
+				source.Kind(
+					r.Cache,
+					&corev1.Namespace{},
+					handler.TypedEnqueueRequestsFromMapFunc(func(ctx context.Context, ns *corev1.Namespace) []reconcile.Request {
+						return r.injectables(ctx, caSecretRef, client.InNamespace(ns.Name))
+					})))
+		}
+	}
+	return b.
 		Named(strings.ToLower(r.Injectable.GroupVersionKind().Kind)).
 		WatchesRawSource(
 			source.Kind(
@@ -33,33 +65,69 @@ func (r *InjectableReconciler) SetupWithManager(mgr ctrl.Manager) error {
 				newUnstructured(r.Injectable),
 				&handler.TypedEnqueueRequestForObject[*unstructured.Unstructured]{},
 				predicate.NewTypedPredicateFuncs(func(obj *unstructured.Unstructured) bool {
-					return obj.GetLabels()[WantInjectFromSecretNamespaceLabel] == r.Opts.Namespace &&
-						obj.GetLabels()[WantInjectFromSecretNameLabel] == r.Opts.CASecret
+					return slices.Contains(r.injectFromSecrets(obj), caSecretRef)
 				}))).
 		WatchesRawSource(
 			r.caSecretSource(
 				handler.TypedEnqueueRequestsFromMapFunc(func(ctx context.Context, _ *corev1.Secret) []reconcile.Request {
-					objList := newUnstructuredList(r.Injectable)
-					if err := r.List(ctx, objList, client.MatchingLabels(map[string]string{
-						WantInjectFromSecretNamespaceLabel: r.Opts.Namespace,
-						WantInjectFromSecretNameLabel:      r.Opts.CASecret,
-					})); err != nil {
-						log.FromContext(ctx).Error(err, "when listing injectables")
-						return nil
-					}
-
-					requests := make([]reconcile.Request, len(objList.Items))
-					for _, obj := range objList.Items {
-						req := reconcile.Request{}
-						req.Namespace = obj.GetNamespace()
-						req.Name = obj.GetName()
-						requests = append(requests, req)
-					}
-					return requests
+					return r.injectables(ctx, caSecretRef)
 				}))).
 		Complete(r)
 }
 
+// injectables returns the requests for the injectables wanting injection
+// from the CA Secret.
+func (r *InjectableReconciler) injectables(ctx context.Context, caSecretRef string, opts ...client.ListOption) []reconcile.Request {
+	objList := newUnstructuredList(r.Injectable)
+	if err := r.Cache.List(ctx, objList, append(opts, client.MatchingFields{injectFromSecretIndex: caSecretRef})...); err != nil {
+		log.FromContext(ctx).Error(err, "when listing injectables")
+		return nil
+	}
+
+	requests := make([]reconcile.Request, 0, len(objList.Items))
+	for _, obj := range objList.Items {
+		req := reconcile.Request{}
+		req.Namespace = obj.GetNamespace()
+		req.Name = obj.GetName()
+		requests = append(requests, req)
+	}
+	return requests
+}
+
+// selectedNamespace returns true if injectables in the namespace are
+// injected, i.e. the namespace matches the InjectableNamespaceSelector. Only
+// the selected namespaces are cached, see ServingCertificateOperator.
+func (r *InjectableReconciler) selectedNamespace(ctx context.Context, namespace string) (bool, error) {
+	if r.Opts.InjectableNamespaceSelector == nil || namespace == "" {
+		return true, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := r.Cache.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return r.Opts.InjectableNamespaceSelector.Matches(labels.Set(ns.Labels)), nil
+}
+
+// injectFromSecrets returns the namespaced names of the Secrets obj wants
+// injection from, selected by the WantInjectFromSecret*Label labels or, in
+// cainjector compatibility mode, the InjectCAFromSecretAnnotation.
+func (r *InjectableReconciler) injectFromSecrets(obj client.Object) []string {
+	var refs []string
+	namespace, name := obj.GetLabels()[WantInjectFromSecretNamespaceLabel], obj.GetLabels()[WantInjectFromSecretNameLabel]
+	if namespace != "" && name != "" {
+		refs = append(refs, types.NamespacedName{Namespace: namespace, Name: name}.String())
+	}
+	if r.Opts.CAInjectorCompatibility {
+		if ref := obj.GetAnnotations()[InjectCAFromSecretAnnotation]; ref != "" && !slices.Contains(refs, ref) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
 func (r *InjectableReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	_ = log.FromContext(ctx)
 
@@ -72,18 +140,53 @@ func (r *InjectableReconciler) Reconcile(ctx context.Context, req ctrl.Request)
 		return ctrl.Result{}, err
 	}
 
-	return ctrl.Result{}, r.reconcileInjectable(ctx, req, secret.Data[TLSCABundleKey])
+	// Only public data of the CA Secret is passed on; never its private key
+	caBundle := CABundle{
+		PEM:     secret.Data[TLSCABundleKey],
+		CRL:     secret.Data[TLSCRLKey],
+		Formats: r.Opts.CABundle.formats(secret.Data),
+	}
+	obj := newUnstructured(r.Injectable)
+	obj.SetNamespace(req.Namespace)
+	obj.SetName(req.Name)
+	return ctrl.Result{}, r.handleError(obj, r.reconcileInjectable(ctx, req, caBundle))
+}
+
+// injectionError returns an *InjectionError for the injectable, for errors
+// retrying won't resolve. API errors are returned as is, to be retried.
+func (r *InjectableReconciler) injectionError(req ctrl.Request, err error) error {
+	return &InjectionError{
+		GroupVersionKind: r.Injectable.GroupVersionKind(),
+		Object:           req.NamespacedName,
+		Err:              err,
+	}
 }
 
-func (r *InjectableReconciler) reconcileInjectable(ctx context.Context, req ctrl.Request, caBundle []byte) error {
+func (r *InjectableReconciler) reconcileInjectable(ctx context.Context, req ctrl.Request, caBundle CABundle) error {
+	if selected, err := r.selectedNamespace(ctx, req.Namespace); err != nil || !selected {
+		return err
+	}
+
 	obj := newUnstructured(r.Injectable)
 	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
-		return err
+		return client.IgnoreNotFound(err)
 	}
 
-	ac, err := r.Injectable.InjectCA(obj, caBundle)
+	// Injecting an empty CA bundle would break TLS verification by all
+	// clients of the injectable
+	if len(caBundle.PEM) == 0 {
+		return r.injectionError(req, fmt.Errorf("CA Secret has no CA bundle"))
+	}
+
+	var ac ApplyConfiguration
+	var err error
+	if caBundleInjectable, ok := r.Injectable.(CABundleInjectable); ok {
+		ac, err = caBundleInjectable.InjectCABundle(obj, caBundle)
+	} else {
+		ac, err = r.Injectable.InjectCA(obj, caBundle.PEM)
+	}
 	if err != nil {
-		return err
+		return r.injectionError(req, err)
 	}
 
 	if err := r.Patch(ctx, obj, newApplyPatch(ac), client.ForceOwnership, fieldOwner); err != nil {
@@ -1,15 +1,20 @@
 package authority
 
 import (
+	"context"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
@@ -36,6 +41,8 @@ var _ = Describe("Injectable Controller", Ordered, func() {
 			corev1.TLSCertKey:       []byte("CA cert injectable"),
 			corev1.TLSPrivateKeyKey: []byte("CA cert key injectable"),
 			TLSCABundleKey:          []byte("CA bundle injectable"),
+			TLSCRLKey:               []byte("CRL injectable"),
+			"ca-0.der":              []byte("CA DER injectable"),
 		}
 		Expect(k8sClient.Create(ctx, caSecret)).To(Succeed())
 		caSecretRef = client.ObjectKeyFromObject(caSecret)
@@ -55,11 +62,18 @@ var _ = Describe("Injectable Controller", Ordered, func() {
 				Opts: Options{
 					Namespace: caSecretRef.Namespace,
 					CASecret:  caSecretRef.Name,
+					CABundle:  CABundleOptions{DERKeyPrefix: "ca-"},
 				}},
 			Injectable: &ValidatingWebhookCaBundleInject{},
 		}
 		Expect(controller.SetupWithManager(k8sManager)).To(Succeed())
 
+		configMapController := &InjectableReconciler{
+			reconciler: controller.reconciler,
+			Injectable: &ConfigMapCaBundleInject{CRLKey: TLSCRLKey},
+		}
+		Expect(configMapController.SetupWithManager(k8sManager)).To(Succeed())
+
 		go func() {
 			defer GinkgoRecover()
 			err = k8sManager.Start(ctx)
@@ -89,4 +103,188 @@ var _ = Describe("Injectable Controller", Ordered, func() {
 		})
 	})
 
+	Context("ConfigMap", func() {
+		var cm *corev1.ConfigMap
+
+		It("should inject CA bundle, CRL and formats into namespaced resource", func() {
+			ns := &corev1.Namespace{}
+			ns.Name = "injectable-configmap"
+			Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+			cm = &corev1.ConfigMap{}
+			cm.Namespace = ns.Name
+			cm.Name = "ca-bundle"
+			cm.Labels = map[string]string{
+				WantInjectFromSecretNamespaceLabel: caSecretRef.Namespace,
+				WantInjectFromSecretNameLabel:      caSecretRef.Name,
+			}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+		})
+
+		It("should update CA bundle when bundle updated", func() {
+			caSecret.Data[TLSCABundleKey] = []byte("updated CA bundle for ConfigMap")
+			Expect(k8sClient.Update(ctx, caSecret)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Eventually(komega.Object(cm)).Should(
+				HaveField("Data", And(
+					HaveKeyWithValue(TLSCABundleKey, string(caSecret.Data[TLSCABundleKey])),
+					HaveKeyWithValue(TLSCRLKey, string(caSecret.Data[TLSCRLKey])),
+				)),
+				HaveField("BinaryData", And(
+					HaveKeyWithValue("ca-0.der", caSecret.Data["ca-0.der"]),
+					Not(HaveKey(corev1.TLSPrivateKeyKey)),
+				)),
+			)
+		})
+	})
+})
+
+var _ = Describe("Injectable Controller in cainjector compatibility mode", Ordered, func() {
+	var (
+		caSecret    *corev1.Secret
+		caSecretRef types.NamespacedName
+	)
+
+	BeforeAll(func() {
+		ns := &corev1.Namespace{}
+		ns.Name = "injectable-controller-compat"
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		caSecret = &corev1.Secret{}
+		caSecret.Namespace = ns.Name
+		caSecret.Name = "ca-cert"
+		caSecret.Type = corev1.SecretTypeTLS
+		caSecret.Labels = map[string]string{
+			DynamicAuthoritySecretLabel: "true",
+		}
+		caSecret.Data = map[string][]byte{
+			corev1.TLSCertKey:       []byte("CA cert compat"),
+			corev1.TLSPrivateKeyKey: []byte("CA cert key compat"),
+			TLSCABundleKey:          []byte("CA bundle compat"),
+		}
+		Expect(k8sClient.Create(ctx, caSecret)).To(Succeed())
+		caSecretRef = client.ObjectKeyFromObject(caSecret)
+
+		k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
+			Scheme: scheme.Scheme,
+			Metrics: metricsserver.Options{
+				BindAddress: "0",
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		controller := &InjectableReconciler{
+			reconciler: reconciler{
+				Client: k8sManager.GetClient(),
+				Cache:  k8sManager.GetCache(),
+				Opts: Options{
+					Namespace:               caSecretRef.Namespace,
+					CASecret:                caSecretRef.Name,
+					CAInjectorCompatibility: true,
+				}},
+			Injectable: &ValidatingWebhookCaBundleInject{},
+		}
+		Expect(controller.SetupWithManager(k8sManager)).To(Succeed())
+
+		go func() {
+			defer GinkgoRecover()
+			err = k8sManager.Start(ctx)
+			Expect(err).ToNot(HaveOccurred(), "failed to run manager")
+		}()
+	})
+
+	Context("cainjector annotation", func() {
+		var vwc *admissionregistrationv1.ValidatingWebhookConfiguration
+
+		It("should inject CA bundle", func() {
+			vwc = NewValidatingWebhookConfigurationForTest("test-vwc-annotated", caSecretRef)
+			vwc.Labels = nil
+			vwc.Annotations = map[string]string{
+				InjectCAFromSecretAnnotation: caSecretRef.String(),
+			}
+			Expect(k8sClient.Create(ctx, vwc)).To(Succeed())
+		})
+
+		It("should update CA bundle when bundle updated", func() {
+			caSecret.Data[TLSCABundleKey] = []byte("updated CA bundle for annotated")
+			Expect(k8sClient.Update(ctx, caSecret)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Eventually(komega.Object(vwc)).Should(
+				HaveField("Webhooks", HaveEach(
+					HaveField("ClientConfig.CABundle", Equal(caSecret.Data[TLSCABundleKey])),
+				)),
+			)
+		})
+	})
+})
+
+var _ = Describe("Injectable namespaces", func() {
+	It("should select injectable namespaces by label", func() {
+		selected := &corev1.Namespace{}
+		selected.Name = "injectable-selected"
+		selected.Labels = map[string]string{"dynamic-authority.example.com/inject": "true"}
+		other := &corev1.Namespace{}
+		other.Name = "injectable-other"
+
+		r := &InjectableReconciler{reconciler: reconciler{
+			Cache: readerCache{Reader: fake.NewClientBuilder().WithObjects(selected, other).Build()},
+			Opts:  Options{InjectableNamespaceSelector: labels.SelectorFromSet(selected.Labels)},
+		}}
+		Expect(r.selectedNamespace(ctx, selected.Name)).To(BeTrue())
+		Expect(r.selectedNamespace(ctx, other.Name)).To(BeFalse())
+		Expect(r.selectedNamespace(ctx, "injectable-missing")).To(BeFalse(), "no namespaces matching is an empty set")
+		Expect(r.selectedNamespace(ctx, "")).To(BeTrue(), "cluster-scoped injectables are always selected")
+
+		r.Opts.InjectableNamespaceSelector = nil
+		Expect(r.selectedNamespace(ctx, other.Name)).To(BeTrue())
+	})
+})
+
+// readerCache is a cache.Cache reading objects from a client.Reader.
+type readerCache struct {
+	cache.Cache
+	client.Reader
+}
+
+func (c readerCache) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	return c.Reader.Get(ctx, key, obj, opts...)
+}
+
+func (c readerCache) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return c.Reader.List(ctx, list, opts...)
+}
+
+var _ = Describe("Injectable secret references", func() {
+	DescribeTable("should select injectables",
+		func(compatibility bool, objLabels, objAnnotations map[string]string, expected []string) {
+			r := &InjectableReconciler{reconciler: reconciler{Opts: Options{CAInjectorCompatibility: compatibility}}}
+			obj := &corev1.ConfigMap{}
+			obj.Labels = objLabels
+			obj.Annotations = objAnnotations
+			Expect(r.injectFromSecrets(obj)).To(Equal(expected))
+		},
+		Entry("by labels", false, map[string]string{
+			WantInjectFromSecretNamespaceLabel: "ns",
+			WantInjectFromSecretNameLabel:      "ca",
+		}, nil, []string{"ns/ca"}),
+		Entry("not by incomplete labels", false, map[string]string{
+			WantInjectFromSecretNameLabel: "ca",
+		}, nil, nil),
+		Entry("not by annotation by default", false, nil, map[string]string{
+			InjectCAFromSecretAnnotation: "ns/ca",
+		}, nil),
+		Entry("by annotation in compatibility mode", true, nil, map[string]string{
+			InjectCAFromSecretAnnotation: "ns/ca",
+		}, []string{"ns/ca"}),
+		Entry("by labels and annotation in compatibility mode", true, map[string]string{
+			WantInjectFromSecretNamespaceLabel: "ns",
+			WantInjectFromSecretNameLabel:      "ca",
+		}, map[string]string{
+			InjectCAFromSecretAnnotation: "other/ca",
+		}, []string{"ns/ca", "other/ca"}),
+	)
 })
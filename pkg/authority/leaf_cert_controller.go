@@ -1,27 +1,65 @@
 package authority
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 
 	"github.com/erikgb/dynamic-authority/internal/pki"
+	pkierrors "github.com/erikgb/dynamic-authority/internal/pki/errors"
 )
 
 // LeafCertReconciler reconciles the leaf/serving certificate
 type LeafCertReconciler struct {
 	reconciler
 	certificateHolder *CertificateHolder
+	// The certificates last issued, reused until they are due for renewal
+	issued *issuedCertificates
+	// The certificate the Pod was last annotated with
+	annotatedLeaf *x509.Certificate
+	// The certificate files last written
+	writtenFiles map[string][]byte
+}
+
+// issuedCertificates are the serving or client certificates issued by a CA.
+type issuedCertificates struct {
+	// The PEM encoded CA certificate
+	caCertData []byte
+	// The PEM encoded serving certificate and private key
+	certData, pkData []byte
+	cert             *tls.Certificate
+	sniCerts         []*tls.Certificate
+}
+
+// revoked returns whether the serving certificate or any of the SNI
+// certificates is in the given revoked serial numbers.
+func (c *issuedCertificates) revoked(revoked map[string]time.Time) bool {
+	if _, ok := revoked[c.cert.Leaf.SerialNumber.String()]; ok {
+		return true
+	}
+	for _, cert := range c.sniCerts {
+		if _, ok := revoked[cert.Leaf.SerialNumber.String()]; ok {
+			return true
+		}
+	}
+	return false
 }
 
 // +kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch
+// +kubebuilder:rbac:groups="",resources=pods,verbs=patch
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *LeafCertReconciler) SetupWithManager(mgr ctrl.Manager) error {
@@ -34,55 +72,177 @@ func (r *LeafCertReconciler) SetupWithManager(mgr ctrl.Manager) error {
 }
 
 func (r *LeafCertReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
-	return ctrl.Result{}, r.reconcileSecret(ctx, req)
+	requeueAfter, err := r.reconcileSecret(ctx, req)
+	if err != nil {
+		return ctrl.Result{}, r.handleError(newSecret(req.NamespacedName), err)
+	}
+	if r.Opts.OCSP.Staple {
+		// Refresh the stapled OCSP responses well before they expire
+		requeueAfter = min(requeueAfter, r.Opts.OCSP.ResponseDuration/2)
+	}
+	return ctrl.Result{RequeueAfter: requeueAfter}, nil
 }
 
-func (r *LeafCertReconciler) reconcileSecret(ctx context.Context, req ctrl.Request) error {
+func (r *LeafCertReconciler) reconcileSecret(ctx context.Context, req ctrl.Request) (time.Duration, error) {
 	caSecret := &corev1.Secret{}
 	if err := r.Get(ctx, req.NamespacedName, caSecret); err != nil {
 		if errors.IsNotFound(err) {
-			return nil
+			return 0, nil
 		}
-		return err
+		return 0, err
 	}
 	caCertBytes := caSecret.Data[corev1.TLSCertKey]
 	caPkBytes := caSecret.Data[corev1.TLSPrivateKeyKey]
-
-	pk, err := pki.GenerateECPrivateKey(384)
+	revoked, err := revokedCertificates(caSecret.Data[TLSCRLKey])
 	if err != nil {
-		return err
+		return 0, pkierrors.NewInvalidData("failed decoding CRL: %v", err)
+	}
+
+	issued := r.issued
+	// Reissue revoked certificates, instead of serving them with a revoked staple
+	if issued == nil || !bytes.Equal(issued.caCertData, caCertBytes) || renewAfter(r.Opts.clock(), issued.cert.Leaf) <= 0 || issued.revoked(revoked) {
+		if issued, err = r.issueCertificates(ctx, caCertBytes, caPkBytes); err != nil {
+			return 0, err
+		}
+		r.issued = issued
 	}
 
-	// create the certificate template to be signed
+	tlsCert, sniCerts := issued.cert, issued.sniCerts
+	if r.Opts.OCSP.Staple {
+		// Staple the certificates issued with a fresh OCSP response
+		stapled, err := staple(r.Opts, caCertBytes, caPkBytes, revoked, append([]*tls.Certificate{tlsCert}, sniCerts...)...)
+		if err != nil {
+			return 0, err
+		}
+		tlsCert, sniCerts = stapled[0], stapled[1:]
+	}
+	if err := r.certificateHolder.SetSNICertificates(sniCerts); err != nil {
+		return 0, err
+	}
+
+	r.certificateHolder.SetCertificate(tlsCert)
+
+	// Only patch the Pod when the serving certificate changed
+	if r.Opts.Pod != nil && !tlsCert.Leaf.Equal(r.annotatedLeaf) {
+		pod := &corev1.Pod{}
+		pod.Namespace = r.Opts.Pod.Namespace
+		pod.Name = r.Opts.Pod.Name
+		ac := r.Opts.Pod.servingCertificateAnnotations(tlsCert.Leaf)
+		if err := r.Patch(ctx, pod, newApplyPatch(ac), client.ForceOwnership, fieldOwner); err != nil {
+			return 0, fmt.Errorf("failed annotating Pod with serving certificate: %w", err)
+		}
+		r.annotatedLeaf = tlsCert.Leaf
+	}
+
+	if r.Opts.CertDir != "" {
+		caBundleData, ok := caSecret.Data[TLSCABundleKey]
+		if !ok {
+			caBundleData = caCertBytes
+		}
+		files := map[string][]byte{
+			// The leaf followed by the issuing CA, for consumers expecting a chain
+			corev1.TLSCertKey:              append(slices.Clone(issued.certData), caCertBytes...),
+			corev1.TLSPrivateKeyKey:        issued.pkData,
+			corev1.ServiceAccountRootCAKey: caBundleData,
+		}
+		// Only write a new version of the files when they changed
+		if !maps.EqualFunc(files, r.writtenFiles, bytes.Equal) {
+			writer := certificateFileWriter{dir: r.Opts.CertDir, mode: r.Opts.CertFileMode}
+			if err := writer.write(files); err != nil {
+				return 0, fmt.Errorf("failed writing certificate files: %w", err)
+			}
+			r.writtenFiles = files
+		}
+	}
+
+	return renewAfter(r.Opts.clock(), tlsCert.Leaf), nil
+}
+
+// issueCertificates issues the serving certificate, and the SNI certificates.
+func (r *LeafCertReconciler) issueCertificates(ctx context.Context, caCertBytes, caPkBytes []byte) (*issuedCertificates, error) {
 	template := &x509.Certificate{
-		Version:            3,
-		PublicKeyAlgorithm: x509.ECDSA,
-		PublicKey:          pk.Public(),
-		DNSNames:           r.Opts.DNSNames,
-		KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
-		ExtKeyUsage:        []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:       r.Opts.DNSNames,
+		IPAddresses:    r.Opts.IPAddresses,
+		URIs:           r.Opts.URIs,
+		EmailAddresses: r.Opts.EmailAddresses,
+	}
+	if r.Opts.Pod != nil {
+		template.DNSNames = append(slices.Clone(template.DNSNames), r.Opts.Pod.DNSNames()...)
+		template.IPAddresses = append(slices.Clone(template.IPAddresses), r.Opts.Pod.IPs...)
+	}
+	certData, pkData, err := r.issueLeaf(ctx, ServerProfile(), template, x509.ECDSA, caCertBytes, caPkBytes)
+	if err != nil {
+		return nil, err
 	}
 
-	cert, err := Sign(r.Opts, template, caCertBytes, caPkBytes)
+	tlsCert, err := newTLSCertificate(certData, pkData)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	pkData, err := pki.EncodePrivateKey(pk)
+	sniCerts := make([]*tls.Certificate, 0, len(r.Opts.SNICertificates))
+	for _, sni := range r.Opts.SNICertificates {
+		sniCertData, sniPkData, err := r.issueLeaf(ctx, ServerProfile(), &x509.Certificate{DNSNames: sni.DNSNames}, sni.KeyAlgorithm, caCertBytes, caPkBytes)
+		if err != nil {
+			return nil, err
+		}
+		sniCert, err := newTLSCertificate(sniCertData, sniPkData)
+		if err != nil {
+			return nil, err
+		}
+		sniCerts = append(sniCerts, sniCert)
+	}
+
+	return &issuedCertificates{
+		caCertData: caCertBytes,
+		certData:   certData,
+		pkData:     pkData,
+		cert:       tlsCert,
+		sniCerts:   sniCerts,
+	}, nil
+}
+
+// issueLeaf issues a leaf certificate of the given profile for the subject and
+// subject alternative names in the given template, with a new private key of
+// the given algorithm. The certificate is linted before it is returned. It
+// returns the PEM encoded certificate and private key.
+func (r reconciler) issueLeaf(ctx context.Context, profile CertificateProfile, template *x509.Certificate, keyAlgorithm x509.PublicKeyAlgorithm, caCertBytes, caPkBytes []byte) ([]byte, []byte, error) {
+	if keyAlgorithm == x509.UnknownPublicKeyAlgorithm {
+		keyAlgorithm = x509.ECDSA
+	}
+	pk, err := pki.GeneratePrivateKey(keyAlgorithm)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	certData, err := pki.EncodeX509(cert)
+	// complete the certificate template to be signed
+	template.PublicKeyAlgorithm = keyAlgorithm
+	template.PublicKey = pk.Public()
+	if r.Opts.OCSP.ResponderURL != "" {
+		template.OCSPServer = []string{r.Opts.OCSP.ResponderURL}
+	}
+
+	cert, err := SignWithProfile(r.Opts, profile, template, caCertBytes, caPkBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	caCert, err := pki.DecodeX509CertificateBytes(caCertBytes)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if err := r.lint(ctx, cert, caCert); err != nil {
+		return nil, nil, err
+	}
+
+	pkData, err := pki.EncodePrivateKey(pk)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	tlsCert, err := tls.X509KeyPair(certData, pkData)
+	certData, err := pki.EncodeX509(cert)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	r.certificateHolder.SetCertificate(&tlsCert)
-	return nil
+	return certData, pkData, nil
 }
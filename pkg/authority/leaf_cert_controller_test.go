@@ -1,18 +1,29 @@
 package authority
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ocsp"
 
 	"github.com/erikgb/dynamic-authority/internal/pki"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	clocktesting "k8s.io/utils/clock/testing"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 )
 
@@ -21,21 +32,44 @@ var _ = Describe("Leaf Certificate Controller", Ordered, func() {
 		caSecret    *corev1.Secret
 		caSecretRef types.NamespacedName
 		certHolder  *CertificateHolder
+		certDir     string
+		pod         *corev1.Pod
 	)
 
 	BeforeAll(func() {
+		certDir = GinkgoT().TempDir()
 		opts := Options{
-			Namespace:    "leaf-cert-controller",
-			CASecret:     "ca-cert",
-			CADuration:   7 * time.Hour,
-			LeafDuration: 1 * time.Hour,
+			Namespace:      "leaf-cert-controller",
+			CASecret:       "ca-cert",
+			CADuration:     7 * time.Hour,
+			LeafDuration:   1 * time.Hour,
+			DNSNames:       []string{"webhook.leaf-cert-controller.svc"},
+			IPAddresses:    []net.IP{net.IPv4(10, 0, 0, 1)},
+			URIs:           []*url.URL{{Scheme: "spiffe", Host: "cluster.local", Path: "/ns/leaf-cert-controller/sa/webhook"}},
+			EmailAddresses: []string{"webhook@leaf-cert-controller.example.com"},
+			CertDir:        certDir,
+			CertFileMode:   0o600,
+			Pod: &PodIdentity{
+				Name:      "operator-0",
+				Namespace: "leaf-cert-controller",
+				IPs:       []net.IP{net.IPv4(10, 1, 2, 3)},
+			},
+			SNICertificates: []SNICertificate{
+				{DNSNames: []string{"*.sni.example.com"}, KeyAlgorithm: x509.RSA},
+			},
 		}
 
 		ns := &corev1.Namespace{}
 		ns.Name = opts.Namespace
 		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
 
-		caCert, caPK, err := generateCA(opts)
+		pod = &corev1.Pod{}
+		pod.Namespace = opts.Pod.Namespace
+		pod.Name = opts.Pod.Name
+		pod.Spec.Containers = []corev1.Container{{Name: "manager", Image: "controller:latest"}}
+		Expect(k8sClient.Create(ctx, pod)).To(Succeed())
+
+		caCert, caPK, err := GenerateCA(opts)
 		Expect(err).ToNot(HaveOccurred())
 		caCertBytes, err := pki.EncodeX509(caCert)
 		Expect(err).ToNot(HaveOccurred())
@@ -93,4 +127,120 @@ var _ = Describe("Leaf Certificate Controller", Ordered, func() {
 			return certHolder.GetCertificate(nil)
 		}).ShouldNot(BeNil())
 	})
+
+	It("should include subject alternative names", func() {
+		Eventually(func() (*tls.Certificate, error) {
+			return certHolder.GetCertificate(nil)
+		}).Should(HaveField("Leaf", And(
+			HaveField("DNSNames", ConsistOf(
+				"webhook.leaf-cert-controller.svc",
+				"operator-0",
+				"10-1-2-3.leaf-cert-controller.pod",
+				"10-1-2-3.leaf-cert-controller.pod.cluster.local",
+			)),
+			HaveField("IPAddresses", ConsistOf(
+				WithTransform(net.IP.String, Equal("10.0.0.1")),
+				WithTransform(net.IP.String, Equal("10.1.2.3")),
+			)),
+			HaveField("URIs", ConsistOf(WithTransform((*url.URL).String, Equal("spiffe://cluster.local/ns/leaf-cert-controller/sa/webhook")))),
+			HaveField("EmailAddresses", ConsistOf("webhook@leaf-cert-controller.example.com")),
+		)))
+	})
+
+	It("should annotate Pod with serving certificate", func() {
+		Eventually(func(g Gomega) {
+			cert, err := certHolder.GetCertificate(nil)
+			g.Expect(err).ToNot(HaveOccurred())
+			g.Expect(komega.Get(pod)()).To(Succeed())
+
+			fingerprint := sha256.Sum256(cert.Leaf.Raw)
+			g.Expect(pod.Annotations).To(And(
+				HaveKeyWithValue(ServingCertificateSerialAnnotation, cert.Leaf.SerialNumber.Text(16)),
+				HaveKeyWithValue(ServingCertificateFingerprintAnnotation, hex.EncodeToString(fingerprint[:])),
+			))
+		}).Should(Succeed())
+	})
+
+	It("should set SNI certificates", func() {
+		Eventually(func() (*tls.Certificate, error) {
+			return certHolder.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.sni.example.com"})
+		}).Should(HaveField("Leaf", And(
+			HaveField("DNSNames", ConsistOf("*.sni.example.com")),
+			HaveField("PublicKeyAlgorithm", Equal(x509.RSA)),
+		)))
+	})
+
+	It("should write certificate files", func() {
+		Eventually(func() (tls.Certificate, error) {
+			return tls.LoadX509KeyPair(
+				filepath.Join(certDir, corev1.TLSCertKey),
+				filepath.Join(certDir, corev1.TLSPrivateKeyKey),
+			)
+		}).Should(HaveField("Certificate", HaveLen(2)), "the leaf followed by the issuing CA")
+
+		caBundle, err := os.ReadFile(filepath.Join(certDir, corev1.ServiceAccountRootCAKey))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pki.DecodeX509CertificateSetBytes(caBundle)).ToNot(BeEmpty())
+	})
+})
+
+var _ = Describe("Leaf Certificate Reconciler", func() {
+	It("should re-staple the serving certificate until it is due for renewal", func() {
+		fakeClock := clocktesting.NewFakePassiveClock(time.Now())
+		opts := Options{
+			Namespace:    "cert-manager",
+			CASecret:     "ca-cert",
+			CADuration:   7 * time.Hour,
+			LeafDuration: 1 * time.Hour,
+			DNSNames:     []string{"webhook.cert-manager.svc"},
+			OCSP:         OCSPOptions{Staple: true, ResponseDuration: 10 * time.Minute},
+			Clock:        fakeClock,
+		}
+		caCert, caPK, err := GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		pkBytes, err := pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		caSecret := newSecret(types.NamespacedName{Namespace: opts.Namespace, Name: opts.CASecret})
+		caSecret.Data = map[string][]byte{
+			corev1.TLSCertKey:       caCertBytes,
+			corev1.TLSPrivateKeyKey: pkBytes,
+		}
+		certHolder := &CertificateHolder{}
+		r := &LeafCertReconciler{
+			reconciler: reconciler{
+				Client: fake.NewClientBuilder().WithObjects(caSecret).Build(),
+				Opts:   opts,
+			},
+			certificateHolder: certHolder,
+		}
+		reconcile := func() (*tls.Certificate, *ocsp.Response) {
+			result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(caSecret)})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(5 * time.Minute))
+			cert, err := certHolder.GetCertificate(nil)
+			Expect(err).ToNot(HaveOccurred())
+			response, err := ocsp.ParseResponseForCert(cert.OCSPStaple, cert.Leaf, caCert)
+			Expect(err).ToNot(HaveOccurred())
+			return cert, response
+		}
+
+		first, firstResponse := reconcile()
+
+		By("re-stapling the same certificate")
+		fakeClock.SetTime(fakeClock.Now().Add(5 * time.Minute))
+		second, secondResponse := reconcile()
+		Expect(second.Leaf.Equal(first.Leaf)).To(BeTrue())
+		Expect(secondResponse.ThisUpdate).To(BeTemporally(">", firstResponse.ThisUpdate))
+		response, err := ocsp.ParseResponseForCert(first.OCSPStaple, first.Leaf, caCert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.ThisUpdate).To(Equal(firstResponse.ThisUpdate), "the certificate previously served is left unchanged")
+
+		By("reissuing the certificate when it is due for renewal")
+		fakeClock.SetTime(fakeClock.Now().Add(40 * time.Minute))
+		third, _ := reconcile()
+		Expect(third.Leaf.Equal(first.Leaf)).To(BeFalse())
+	})
 })
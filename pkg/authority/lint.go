@@ -0,0 +1,73 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+// LintOptions configures the checks of certificates before they are
+// published, i.e. the CA before it is stored in the CA Secret, and leaf
+// certificates before they are served.
+type LintOptions struct {
+	// The severity of findings by rule. Rules not listed are errors,
+	// preventing the certificate from being published. Warnings are logged.
+	Severities map[LintRule]LintSeverity
+}
+
+// LintRule identifies a check of certificates before they are published.
+type LintRule = pki.LintRule
+
+const (
+	// LintRuleKeyUsage checks that the key usages match the key type and
+	// whether the certificate is a CA.
+	LintRuleKeyUsage = pki.LintRuleKeyUsage
+	// LintRuleKeyIdentifier checks for subject and authority key
+	// identifiers.
+	LintRuleKeyIdentifier = pki.LintRuleKeyIdentifier
+	// LintRuleValidity checks that certificates are not valid outside of
+	// the validity of their issuer.
+	LintRuleValidity = pki.LintRuleValidity
+	// LintRuleSubjectAltName checks the syntax of subject alternative names.
+	LintRuleSubjectAltName = pki.LintRuleSubjectAltName
+	// LintRuleSerialNumber checks the length of serial numbers.
+	LintRuleSerialNumber = pki.LintRuleSerialNumber
+	// LintRuleWeakAlgorithm checks for weak signature algorithms and keys.
+	LintRuleWeakAlgorithm = pki.LintRuleWeakAlgorithm
+)
+
+// LintSeverity is the severity of findings of a LintRule.
+type LintSeverity = pki.LintSeverity
+
+const (
+	LintSeverityError   = pki.LintSeverityError
+	LintSeverityWarning = pki.LintSeverityWarning
+	LintSeverityIgnore  = pki.LintSeverityIgnore
+)
+
+var lintRules = []LintRule{
+	LintRuleKeyUsage,
+	LintRuleKeyIdentifier,
+	LintRuleValidity,
+	LintRuleSubjectAltName,
+	LintRuleSerialNumber,
+	LintRuleWeakAlgorithm,
+}
+
+// lint checks a certificate issued by issuer before it is published. Warnings
+// are logged, and an error matching ErrLintFailed is returned if the
+// certificate must not be published.
+func (r reconciler) lint(ctx context.Context, cert, issuer *x509.Certificate) error {
+	linter := pki.Linter{Severities: r.Opts.Lint.Severities}
+	findings, err := linter.Lint(cert, issuer)
+	for _, f := range findings {
+		if f.Severity == LintSeverityWarning {
+			log.FromContext(ctx).Info("Certificate lint warning", "rule", f.Rule, "message", f.Message,
+				"subject", cert.Subject.String(), "serial", cert.SerialNumber.Text(16))
+		}
+	}
+	return err
+}
@@ -0,0 +1,116 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+var _ = Describe("Lint", func() {
+	var (
+		r                      reconciler
+		caCert                 *x509.Certificate
+		caPK                   crypto.Signer
+		caCertBytes, caPkBytes []byte
+		badCert                func() *x509.Certificate
+		err                    error
+	)
+
+	BeforeEach(func() {
+		r = reconciler{Opts: Options{CADuration: 7 * 24 * time.Hour, LeafDuration: 24 * time.Hour}}
+		caCert, caPK, err = GenerateCA(r.Opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err = pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caPkBytes, err = pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		// A certificate signed without the authority, with the mistakes the
+		// linter catches
+		badCert = func() *x509.Certificate {
+			GinkgoHelper()
+			pk, err := pki.GenerateECPrivateKey(pki.ECCurve256)
+			Expect(err).ToNot(HaveOccurred())
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(42),
+				DNSNames:     []string{"foo_bar.example.com"},
+				NotBefore:    caCert.NotBefore,
+				NotAfter:     caCert.NotAfter.Add(time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+			}
+			der, err := x509.CreateCertificate(rand.Reader, template, caCert, pk.Public(), caPK)
+			Expect(err).ToNot(HaveOccurred())
+			cert, err := x509.ParseCertificate(der)
+			Expect(err).ToNot(HaveOccurred())
+			return cert
+		}
+	})
+
+	It("should not find problems in certificates issued by the authority", func() {
+		Expect(r.lint(ctx, caCert, caCert)).To(Succeed())
+		for _, keyAlgorithm := range []x509.PublicKeyAlgorithm{x509.ECDSA, x509.RSA, x509.Ed25519} {
+			certData, _, err := r.issueLeaf(ctx, ServerProfile(), &x509.Certificate{DNSNames: []string{"foo.example.com"}}, keyAlgorithm, caCertBytes, caPkBytes)
+			Expect(err).ToNot(HaveOccurred())
+			leaf, err := pki.DecodeX509CertificateBytes(certData)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(leaf.SubjectKeyId).ToNot(BeEmpty())
+			Expect(leaf.AuthorityKeyId).To(Equal(caCert.SubjectKeyId))
+			Expect(leaf.KeyUsage&x509.KeyUsageKeyEncipherment != 0).To(Equal(keyAlgorithm == x509.RSA))
+
+			findings, err := pki.Linter{}.Lint(leaf, caCert)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(findings).To(BeEmpty())
+		}
+	})
+
+	It("should report problems as errors by default", func() {
+		findings, err := pki.Linter{}.Lint(badCert(), caCert)
+		Expect(err).To(MatchError(ErrLintFailed))
+		Expect(findings).To(ContainElements(
+			HaveField("Rule", LintRuleKeyUsage),
+			HaveField("Rule", LintRuleKeyIdentifier),
+			HaveField("Rule", LintRuleValidity),
+			HaveField("Rule", LintRuleSubjectAltName),
+			HaveField("Rule", LintRuleSerialNumber),
+		))
+		Expect(findings).To(HaveEach(HaveField("Severity", LintSeverityError)))
+	})
+
+	It("should report problems by configured severity", func() {
+		linter := pki.Linter{Severities: map[LintRule]LintSeverity{}}
+		for _, rule := range lintRules {
+			linter.Severities[rule] = LintSeverityWarning
+		}
+		linter.Severities[LintRuleSerialNumber] = LintSeverityIgnore
+
+		findings, err := linter.Lint(badCert(), caCert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(findings).ToNot(BeEmpty())
+		Expect(findings).To(HaveEach(HaveField("Severity", LintSeverityWarning)))
+		Expect(findings).ToNot(ContainElement(HaveField("Rule", LintRuleSerialNumber)))
+	})
+
+	DescribeTable("should check the length of serial numbers",
+		func(bitLen int, valid bool) {
+			cert := &x509.Certificate{SerialNumber: new(big.Int).Lsh(big.NewInt(1), uint(bitLen-1))}
+			findings, _ := pki.Linter{}.Lint(cert, caCert)
+			if valid {
+				Expect(findings).ToNot(ContainElement(HaveField("Rule", LintRuleSerialNumber)))
+			} else {
+				Expect(findings).To(ContainElement(HaveField("Rule", LintRuleSerialNumber)))
+			}
+		},
+		Entry("7 octets", 55, false),
+		Entry("8 octets", 56, true),
+		Entry("20 octets", 159, true),
+		Entry("21 octets", 160, false),
+	)
+})
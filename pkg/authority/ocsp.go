@@ -0,0 +1,297 @@
+package authority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+	"k8s.io/utils/ptr"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+// OCSPOptions configures the OCSP responder and OCSP stapling.
+type OCSPOptions struct {
+	// If set, the serving certificates are stapled with an OCSP response.
+	// Serving certificates revoked in the CRL of the CA are reissued.
+	Staple bool
+
+	// The URL of the OCSP responder, included in the serving certificates.
+	// See ServingCertificateOperator.OCSPResponder.
+	ResponderURL string
+
+	// The amount of time OCSP responses are valid for.
+	// Defaults to 1 hour.
+	ResponseDuration time.Duration
+
+	// If set, the OCSP responder signs responses using a delegated responder
+	// certificate issued by the CA, instead of signing with the CA itself.
+	DelegatedResponder bool
+}
+
+// oidOCSPNoCheck is the id-pkix-ocsp-nocheck extension, telling clients not
+// to check the revocation status of a delegated responder certificate.
+var oidOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+
+// OCSPResponder is an http.Handler answering OCSP requests, as specified by
+// RFC 6960, for certificates issued by the current dynamic CA. Requests for
+// certificates issued by previous CAs are answered until those CAs expire,
+// signed by the previous CA, as long as the responder observed the rotation;
+// otherwise they are answered as unauthorized. Certificates listed in the CRL
+// of the CA are reported as revoked, and serial numbers the CA never issued
+// as unknown. It supports both GET and POST requests.
+type OCSPResponder struct {
+	// The signers of the current CA, followed by those of previous CAs.
+	signersP atomic.Pointer[[]*ocspSigner]
+}
+
+// ocspSigner signs OCSP responses on behalf of a CA.
+type ocspSigner struct {
+	opts   Options
+	caCert *x509.Certificate
+	caPk   crypto.Signer
+	// The key tagging the serial numbers issued by the CA.
+	serialNumberKey []byte
+	// The revocation time of revoked certificates, by serial number.
+	revoked map[string]time.Time
+	// The certificate and key signing responses; either the CA itself or a
+	// delegated responder.
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// newOCSPSigner returns an ocspSigner signing responses with the CA itself.
+func newOCSPSigner(opts Options, caCert *x509.Certificate, caPk crypto.Signer, revoked map[string]time.Time) (*ocspSigner, error) {
+	key, err := serialNumberKey(caPk)
+	if err != nil {
+		return nil, err
+	}
+	return &ocspSigner{opts: opts, caCert: caCert, caPk: caPk, serialNumberKey: key, revoked: revoked, cert: caCert, key: caPk}, nil
+}
+
+// setCA updates the CA responses are given for, and its PEM encoded CRL.
+// It returns when the responder should be updated again, to renew the
+// delegated responder certificate.
+func (rsp *OCSPResponder) setCA(opts Options, caCertBytes, caPkBytes, crlBytes []byte) (time.Duration, error) {
+	caCert, err := pki.DecodeX509CertificateBytes(caCertBytes)
+	if err != nil {
+		return 0, err
+	}
+	caPk, err := pki.DecodePrivateKeyBytes(caPkBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked, err := revokedCertificates(crlBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	signer, err := newOCSPSigner(opts, caCert, caPk, revoked)
+	if err != nil {
+		return 0, err
+	}
+
+	var current *ocspSigner
+	var previous []*ocspSigner
+	if signers := rsp.signersP.Load(); signers != nil {
+		current, previous = (*signers)[0], (*signers)[1:]
+	}
+	if current != nil && !current.caCert.Equal(caCert) {
+		// Keep answering for the certificates issued by the rotated CA,
+		// signing with the CA itself as its delegated responder is not renewed
+		rotated, err := newOCSPSigner(current.opts, current.caCert, current.caPk, current.revoked)
+		if err != nil {
+			return 0, err
+		}
+		previous = append([]*ocspSigner{rotated}, previous...)
+		current = nil
+	}
+	// Previous CAs are only kept until they expire, like the certificates
+	// they issued
+	now := opts.clock().Now()
+	previous = slices.DeleteFunc(slices.Clone(previous), func(s *ocspSigner) bool {
+		return !now.Before(s.caCert.NotAfter) || s.caCert.Equal(caCert)
+	})
+
+	if !opts.OCSP.DelegatedResponder {
+		rsp.signersP.Store(ptr.To(append([]*ocspSigner{signer}, previous...)))
+		return 0, nil
+	}
+
+	if current != nil && current.cert != current.caCert && renewAfter(opts.clock(), current.cert) > 0 {
+		signer.cert, signer.key = current.cert, current.key
+	} else {
+		signer.key, err = pki.GenerateECPrivateKey(pki.ECCurve256)
+		if err != nil {
+			return 0, err
+		}
+		signer.cert, err = SignWithProfile(opts, ocspResponderProfile(), &x509.Certificate{
+			Subject:         pkix.Name{CommonName: "cert-manager-dynamic-ocsp-responder"},
+			PublicKey:       signer.key.Public(),
+			ExtraExtensions: []pkix.Extension{{Id: oidOCSPNoCheck, Value: asn1.NullBytes}},
+		}, caCertBytes, caPkBytes)
+		if err != nil {
+			return 0, fmt.Errorf("failed issuing OCSP responder certificate: %w", err)
+		}
+	}
+	rsp.signersP.Store(ptr.To(append([]*ocspSigner{signer}, previous...)))
+
+	return renewAfter(opts.clock(), signer.cert), nil
+}
+
+func (rsp *OCSPResponder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		body []byte
+		err  error
+	)
+	switch req.Method {
+	case http.MethodGet:
+		// The request is the last path segment, URL encoded, as it may
+		// contain "/" characters.
+		escapedPath := req.URL.EscapedPath()
+		var encoded string
+		encoded, err = url.PathUnescape(escapedPath[strings.LastIndex(escapedPath, "/")+1:])
+		if err == nil {
+			body, err = base64.StdEncoding.DecodeString(encoded)
+		}
+	case http.MethodPost:
+		body, err = io.ReadAll(io.LimitReader(req.Body, 10*1024))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := ocsp.MalformedRequestErrorResponse
+	if err == nil {
+		response = rsp.respond(req, body)
+	}
+
+	w.Header().Set("Content-Type", "application/ocsp-response")
+	_, _ = w.Write(response)
+}
+
+func (rsp *OCSPResponder) respond(req *http.Request, body []byte) []byte {
+	log := ctrl.LoggerFrom(req.Context())
+
+	ocspReq, err := ocsp.ParseRequest(body)
+	if err != nil {
+		return ocsp.MalformedRequestErrorResponse
+	}
+
+	signers := rsp.signersP.Load()
+	if signers == nil {
+		return ocsp.TryLaterErrorResponse
+	}
+	i := slices.IndexFunc(*signers, func(s *ocspSigner) bool {
+		issued, err := s.issued(ocspReq)
+		return err == nil && issued
+	})
+	if i < 0 {
+		return ocsp.UnauthorizedErrorResponse
+	}
+
+	response, err := (*signers)[i].createResponse(ocspReq.SerialNumber)
+	if err != nil {
+		log.Error(err, "when creating OCSP response")
+		return ocsp.InternalErrorErrorResponse
+	}
+	return response
+}
+
+// issued returns true if the OCSP request is for a certificate issued by the
+// CA of the signer.
+func (s *ocspSigner) issued(req *ocsp.Request) (bool, error) {
+	if !req.HashAlgorithm.Available() {
+		return false, fmt.Errorf("unsupported hash algorithm: %v", req.HashAlgorithm)
+	}
+
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(s.caCert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false, err
+	}
+
+	h := req.HashAlgorithm.New()
+	h.Write(s.caCert.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	return bytes.Equal(req.IssuerNameHash, nameHash) && bytes.Equal(req.IssuerKeyHash, keyHash), nil
+}
+
+// createResponse returns a DER encoded OCSP response for the certificate
+// with the given serial number.
+func (s *ocspSigner) createResponse(serialNumber *big.Int) ([]byte, error) {
+	now := s.opts.clock().Now().Truncate(time.Minute)
+	template := ocsp.Response{
+		Status:       ocsp.Good,
+		SerialNumber: serialNumber,
+		ThisUpdate:   now,
+		NextUpdate:   now.Add(s.opts.OCSP.ResponseDuration),
+	}
+	if !issuedSerialNumber(s.serialNumberKey, serialNumber) {
+		template.Status = ocsp.Unknown
+	} else if revokedAt, ok := s.revoked[serialNumber.String()]; ok {
+		template.Status = ocsp.Revoked
+		template.RevokedAt = revokedAt
+		template.RevocationReason = ocsp.Unspecified
+	}
+	if s.cert != s.caCert {
+		template.Certificate = s.cert
+	}
+
+	return ocsp.CreateResponse(s.caCert, s.cert, template, s.key)
+}
+
+// staple returns copies of the given certificates with an OCSP response,
+// signed by the CA, stapled. The responses report the certificates in revoked,
+// as read from the CRL of the CA, as revoked. The given certificates are left
+// unchanged, as they may be in use by TLS handshakes.
+func staple(opts Options, caCertBytes, caPkBytes []byte, revoked map[string]time.Time, certs ...*tls.Certificate) ([]*tls.Certificate, error) {
+	caCert, err := pki.DecodeX509CertificateBytes(caCertBytes)
+	if err != nil {
+		return nil, err
+	}
+	caPk, err := pki.DecodePrivateKeyBytes(caPkBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := newOCSPSigner(opts, caCert, caPk, revoked)
+	if err != nil {
+		return nil, err
+	}
+	stapled := make([]*tls.Certificate, 0, len(certs))
+	for _, cert := range certs {
+		if cert.Leaf == nil {
+			return nil, errors.New("tls.Certificate has no parsed leaf")
+		}
+		cert := *cert
+		if cert.OCSPStaple, err = signer.createResponse(cert.Leaf.SerialNumber); err != nil {
+			return nil, fmt.Errorf("failed creating OCSP staple: %w", err)
+		}
+		stapled = append(stapled, &cert)
+	}
+	return stapled, nil
+}
@@ -0,0 +1,228 @@
+package authority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ocsp"
+	corev1 "k8s.io/api/core/v1"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+var _ = Describe("OCSP", func() {
+	var (
+		opts        Options
+		caCert      *x509.Certificate
+		caCertBytes []byte
+		caPkBytes   []byte
+		issue       func() *tls.Certificate
+	)
+
+	BeforeEach(func() {
+		opts = Options{
+			CADuration:   time.Hour,
+			LeafDuration: time.Hour,
+			OCSP:         OCSPOptions{ResponseDuration: time.Hour},
+		}
+		var (
+			caPK crypto.Signer
+			err  error
+		)
+		caCert, caPK, err = GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err = pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caPkBytes, err = pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		r := &LeafCertReconciler{reconciler: reconciler{Opts: opts}}
+		issue = func() *tls.Certificate {
+			certData, pkData, err := r.issueLeaf(ctx, ServerProfile(), &x509.Certificate{DNSNames: []string{"foo.example.com"}}, x509.ECDSA, caCertBytes, caPkBytes)
+			Expect(err).ToNot(HaveOccurred())
+			cert, err := newTLSCertificate(certData, pkData)
+			Expect(err).ToNot(HaveOccurred())
+			return cert
+		}
+	})
+
+	It("should staple OCSP responses", func() {
+		stapled, err := staple(opts, caCertBytes, caPkBytes, nil, issue())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stapled).To(HaveLen(1))
+		cert := stapled[0]
+
+		response, err := ocsp.ParseResponseForCert(cert.OCSPStaple, cert.Leaf, caCert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Status).To(Equal(ocsp.Good))
+		Expect(response.SerialNumber).To(Equal(cert.Leaf.SerialNumber))
+		Expect(response.NextUpdate.Sub(response.ThisUpdate)).To(Equal(time.Hour))
+	})
+
+	It("should staple revoked OCSP responses for revoked certificates", func() {
+		opts.CRLDuration = time.Hour
+		cert := issue()
+		caPK, err := pki.DecodePrivateKeyBytes(caPkBytes)
+		Expect(err).ToNot(HaveOccurred())
+		secret := &corev1.Secret{}
+		secret.Annotations = map[string]string{RevokeCertificatesAnnotation: cert.Leaf.SerialNumber.Text(16)}
+		crlBytes, _, err := generateCRL(opts, secret, caCert, caPK)
+		Expect(err).ToNot(HaveOccurred())
+		revoked, err := revokedCertificates(crlBytes)
+		Expect(err).ToNot(HaveOccurred())
+
+		stapled, err := staple(opts, caCertBytes, caPkBytes, revoked, cert, issue())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(stapled).To(HaveLen(2))
+
+		response, err := ocsp.ParseResponseForCert(stapled[0].OCSPStaple, stapled[0].Leaf, caCert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Status).To(Equal(ocsp.Revoked))
+		response, err = ocsp.ParseResponseForCert(stapled[1].OCSPStaple, stapled[1].Leaf, caCert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Status).To(Equal(ocsp.Good))
+	})
+
+	It("should report revoked certificates", func() {
+		opts.CRLDuration = time.Hour
+		cert := issue()
+		caPK, err := pki.DecodePrivateKeyBytes(caPkBytes)
+		Expect(err).ToNot(HaveOccurred())
+		secret := &corev1.Secret{}
+		secret.Annotations = map[string]string{RevokeCertificatesAnnotation: cert.Leaf.SerialNumber.Text(16)}
+		crlBytes, _, err := generateCRL(opts, secret, caCert, caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		responder := &OCSPResponder{}
+		_, err = responder.setCA(opts, caCertBytes, caPkBytes, crlBytes)
+		Expect(err).ToNot(HaveOccurred())
+		response, err := (*responder.signersP.Load())[0].createResponse(cert.Leaf.SerialNumber)
+		Expect(err).ToNot(HaveOccurred())
+
+		parsed, err := ocsp.ParseResponseForCert(response, cert.Leaf, caCert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.Status).To(Equal(ocsp.Revoked))
+		Expect(parsed.RevokedAt).ToNot(BeZero())
+	})
+
+	It("should report serial numbers not issued by the CA as unknown", func() {
+		responder := &OCSPResponder{}
+		_, err := responder.setCA(opts, caCertBytes, caPkBytes, nil)
+		Expect(err).ToNot(HaveOccurred())
+		cert := issue()
+		serialNumber := new(big.Int).Add(cert.Leaf.SerialNumber, big.NewInt(1))
+		response, err := (*responder.signersP.Load())[0].createResponse(serialNumber)
+		Expect(err).ToNot(HaveOccurred())
+
+		parsed, err := ocsp.ParseResponse(response, caCert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(parsed.Status).To(Equal(ocsp.Unknown))
+	})
+
+	It("should answer for certificates of the previous CA until it expires", func() {
+		fakeClock := clocktesting.NewFakePassiveClock(time.Now())
+		opts.Clock = fakeClock
+		opts.OCSP.DelegatedResponder = true
+		responder := &OCSPResponder{}
+		_, err := responder.setCA(opts, caCertBytes, caPkBytes, nil)
+		Expect(err).ToNot(HaveOccurred())
+		cert := issue()
+		request, err := ocsp.CreateRequest(cert.Leaf, caCert, nil)
+		Expect(err).ToNot(HaveOccurred())
+		query := func() []byte {
+			return responder.respond(httptest.NewRequest(http.MethodPost, "/", nil), request)
+		}
+
+		By("rotating the CA")
+		newCACert, newCAPK, err := GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		newCACertBytes, err := pki.EncodeX509(newCACert)
+		Expect(err).ToNot(HaveOccurred())
+		newCAPkBytes, err := pki.EncodePrivateKey(newCAPK)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = responder.setCA(opts, newCACertBytes, newCAPkBytes, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		response, err := ocsp.ParseResponseForCert(query(), cert.Leaf, caCert)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Status).To(Equal(ocsp.Good))
+		Expect(response.Certificate).To(BeNil(), "signed by the previous CA itself")
+
+		By("refusing requests once the previous CA expired")
+		fakeClock.SetTime(caCert.NotAfter)
+		_, err = responder.setCA(opts, newCACertBytes, newCAPkBytes, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(query()).To(Equal(ocsp.UnauthorizedErrorResponse))
+	})
+
+	DescribeTable("should answer OCSP requests",
+		func(delegated bool, method string) {
+			opts.OCSP.DelegatedResponder = delegated
+			responder := &OCSPResponder{}
+			server := httptest.NewServer(responder)
+			defer server.Close()
+
+			cert := issue()
+			request, err := ocsp.CreateRequest(cert.Leaf, caCert, nil)
+			Expect(err).ToNot(HaveOccurred())
+
+			query := func() []byte {
+				var resp *http.Response
+				if method == http.MethodGet {
+					resp, err = http.Get(server.URL + "/" + url.PathEscape(base64.StdEncoding.EncodeToString(request)))
+				} else {
+					resp, err = http.Post(server.URL, "application/ocsp-request", bytes.NewReader(request))
+				}
+				Expect(err).ToNot(HaveOccurred())
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+				Expect(err).ToNot(HaveOccurred())
+				return body
+			}
+
+			By("answering try later until the CA is known")
+			Expect(query()).To(Equal(ocsp.TryLaterErrorResponse))
+
+			requeueAfter, err := responder.setCA(opts, caCertBytes, caPkBytes, nil)
+			Expect(err).ToNot(HaveOccurred())
+			if delegated {
+				Expect(requeueAfter).To(BeNumerically(">", 0))
+			} else {
+				Expect(requeueAfter).To(BeZero())
+			}
+
+			response, err := ocsp.ParseResponseForCert(query(), cert.Leaf, caCert)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.Status).To(Equal(ocsp.Good))
+			if delegated {
+				Expect(response.Certificate).ToNot(BeNil())
+				Expect(response.Certificate.ExtKeyUsage).To(ConsistOf(x509.ExtKeyUsageOCSPSigning))
+			} else {
+				Expect(response.Certificate).To(BeNil())
+			}
+
+			By("refusing requests for certificates of other CAs")
+			otherCA, _, err := GenerateCA(opts)
+			Expect(err).ToNot(HaveOccurred())
+			request, err = ocsp.CreateRequest(cert.Leaf, otherCA, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(query()).To(Equal(ocsp.UnauthorizedErrorResponse))
+		},
+		Entry("signed by CA using GET", false, http.MethodGet),
+		Entry("signed by CA using POST", false, http.MethodPost),
+		Entry("signed by delegated responder using GET", true, http.MethodGet),
+		Entry("signed by delegated responder using POST", true, http.MethodPost),
+	)
+})
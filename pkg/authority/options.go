@@ -0,0 +1,324 @@
+package authority
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/clock"
+)
+
+// setDefaults sets the default values of unset options.
+func (o *Options) setDefaults() {
+	if o.CADuration == 0 {
+		o.CADuration = 7 * 24 * time.Hour
+	}
+	if o.LeafDuration == 0 {
+		o.LeafDuration = 1 * 24 * time.Hour
+	}
+	if o.CABundle.MaxCertificates == 0 {
+		o.CABundle.MaxCertificates = 5
+	}
+	if o.ClientCertificate.CommonName == "" {
+		o.ClientCertificate.CommonName = "cert-manager-dynamic-client"
+	}
+	if o.CRLDuration == 0 {
+		o.CRLDuration = 24 * time.Hour
+	}
+	if o.OCSP.ResponseDuration == 0 {
+		o.OCSP.ResponseDuration = 1 * time.Hour
+	}
+	if o.CertFileMode == 0 {
+		o.CertFileMode = 0o600
+	}
+	if o.InjectableDiscoveryInterval == 0 {
+		o.InjectableDiscoveryInterval = 10 * time.Second
+	}
+	if len(o.Injectables) == 0 {
+		o.Injectables = []Injectable{
+			&ValidatingWebhookCaBundleInject{},
+		}
+	}
+}
+
+// clock returns the clock of the options, defaulting to the real clock.
+func (o Options) clock() clock.PassiveClock {
+	if o.Clock == nil {
+		return clock.RealClock{}
+	}
+	return o.Clock
+}
+
+// Validate validates the options, with unset options defaulted as done by
+// ServingCertificateOperator.SetupWithManager. It returns an aggregate of
+// all invalid fields, or nil if the options are valid.
+func (o Options) Validate() error {
+	o.setDefaults()
+	return o.validate().ToAggregate()
+}
+
+// validate returns the invalid fields of defaulted options.
+func (o Options) validate() field.ErrorList {
+	allErrs := o.validateCA()
+
+	allErrs = append(allErrs, validateName(field.NewPath("ClientCASecret"), o.ClientCASecret, validation.IsDNS1123Subdomain, false)...)
+	if o.ClientCASecret != "" && o.ClientCASecret == o.CASecret {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("ClientCASecret"), o.ClientCASecret, "must differ from CASecret"))
+	}
+
+	if len(o.DNSNames) == 0 && len(o.IPAddresses) == 0 && len(o.URIs) == 0 && o.Pod == nil {
+		allErrs = append(allErrs, field.Required(field.NewPath("DNSNames"), "at least one DNS name, IP address, URI or Pod identity is required for the serving certificate"))
+	}
+	allErrs = append(allErrs, validateDNSNames(field.NewPath("DNSNames"), o.DNSNames)...)
+	allErrs = append(allErrs, validateIPAddresses(field.NewPath("IPAddresses"), o.IPAddresses)...)
+	allErrs = append(allErrs, validateURIs(field.NewPath("URIs"), o.URIs)...)
+	allErrs = append(allErrs, validateEmailAddresses(field.NewPath("EmailAddresses"), o.EmailAddresses)...)
+	for i, sni := range o.SNICertificates {
+		fldPath := field.NewPath("SNICertificates").Index(i)
+		if len(sni.DNSNames) == 0 {
+			allErrs = append(allErrs, field.Required(fldPath.Child("DNSNames"), ""))
+		}
+		allErrs = append(allErrs, validateDNSNames(fldPath.Child("DNSNames"), sni.DNSNames)...)
+		switch sni.KeyAlgorithm {
+		case x509.UnknownPublicKeyAlgorithm, x509.ECDSA, x509.RSA, x509.Ed25519:
+		default:
+			allErrs = append(allErrs, field.NotSupported(fldPath.Child("KeyAlgorithm"), sni.KeyAlgorithm.String(),
+				[]string{x509.ECDSA.String(), x509.RSA.String(), x509.Ed25519.String()}))
+		}
+	}
+	if o.Pod != nil {
+		fldPath := field.NewPath("Pod")
+		allErrs = append(allErrs, validateName(fldPath.Child("Name"), o.Pod.Name, validation.IsDNS1123Subdomain, true)...)
+		allErrs = append(allErrs, validateName(fldPath.Child("Namespace"), o.Pod.Namespace, validation.IsDNS1123Label, true)...)
+		allErrs = append(allErrs, validateIPAddresses(fldPath.Child("IPs"), o.Pod.IPs)...)
+	}
+
+	if o.OCSP.ResponderURL != "" {
+		fldPath := field.NewPath("OCSP", "ResponderURL")
+		if u, err := url.Parse(o.OCSP.ResponderURL); err != nil {
+			allErrs = append(allErrs, field.Invalid(fldPath, o.OCSP.ResponderURL, err.Error()))
+		} else if u.Scheme != "http" && u.Scheme != "https" {
+			allErrs = append(allErrs, field.Invalid(fldPath, o.OCSP.ResponderURL, "must be an absolute http or https URL"))
+		}
+	}
+
+	allErrs = append(allErrs, validateInjectables(field.NewPath("Injectables"), o.Injectables)...)
+
+	return allErrs
+}
+
+// validateCA returns the invalid fields of defaulted options used to generate
+// and publish the CA, which are all those used by Render.
+func (o Options) validateCA() field.ErrorList {
+	var allErrs field.ErrorList
+
+	allErrs = append(allErrs, validateName(field.NewPath("Namespace"), o.Namespace, validation.IsDNS1123Label, true)...)
+	allErrs = append(allErrs, validateName(field.NewPath("CASecret"), o.CASecret, validation.IsDNS1123Subdomain, true)...)
+	allErrs = append(allErrs, validateDurations(o)...)
+	if o.CABundle.MaxCertificates < 1 {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("CABundle", "MaxCertificates"), o.CABundle.MaxCertificates, "must be at least 1"))
+	}
+	allErrs = append(allErrs, validateCABundleFormats(field.NewPath("CABundle"), o.CABundle, o.CASecret)...)
+	for rule, severity := range o.Lint.Severities {
+		fldPath := field.NewPath("Lint", "Severities").Key(string(rule))
+		if !slices.Contains(lintRules, rule) {
+			allErrs = append(allErrs, field.NotSupported(fldPath, rule, lintRules))
+		}
+		switch severity {
+		case LintSeverityError, LintSeverityWarning, LintSeverityIgnore:
+		default:
+			allErrs = append(allErrs, field.NotSupported(fldPath, severity.String(),
+				[]string{LintSeverityError.String(), LintSeverityWarning.String(), LintSeverityIgnore.String()}))
+		}
+	}
+
+	return allErrs
+}
+
+func validateName(fldPath *field.Path, name string, isValid func(string) []string, required bool) field.ErrorList {
+	if name == "" {
+		if required {
+			return field.ErrorList{field.Required(fldPath, "")}
+		}
+		return nil
+	}
+	var allErrs field.ErrorList
+	for _, msg := range isValid(name) {
+		allErrs = append(allErrs, field.Invalid(fldPath, name, msg))
+	}
+	return allErrs
+}
+
+func validateDurations(o Options) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for _, d := range []struct {
+		path     *field.Path
+		duration time.Duration
+	}{
+		{field.NewPath("CADuration"), o.CADuration},
+		{field.NewPath("LeafDuration"), o.LeafDuration},
+		{field.NewPath("NotBeforeBackdate"), o.NotBeforeBackdate},
+		{field.NewPath("CRLDuration"), o.CRLDuration},
+		{field.NewPath("CABundle", "ExpiryGracePeriod"), o.CABundle.ExpiryGracePeriod},
+		{field.NewPath("OCSP", "ResponseDuration"), o.OCSP.ResponseDuration},
+		{field.NewPath("InjectableDiscoveryInterval"), o.InjectableDiscoveryInterval},
+	} {
+		if d.duration < 0 {
+			allErrs = append(allErrs, field.Invalid(d.path, d.duration.String(), "must not be negative"))
+		}
+	}
+	if len(allErrs) > 0 {
+		return allErrs
+	}
+
+	// Leaf certificates are renewed after 2/3 of their lifetime, and the CA
+	// is rotated after 2/3 of its lifetime. The previous CA stays trusted for
+	// the remaining third, so a leaf issued just before the rotation must
+	// reach its renewal point before the previous CA expires.
+	if o.LeafDuration*2 >= o.CADuration {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("LeafDuration"), o.LeafDuration.String(),
+			fmt.Sprintf("must be less than half of CADuration (%s)", o.CADuration)))
+	}
+	// Backdating extends the lifetime renewal is computed from, so it must
+	// stay within the third of LeafDuration left after renewal
+	if o.NotBeforeBackdate*3 >= o.LeafDuration {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("NotBeforeBackdate"), o.NotBeforeBackdate.String(),
+			fmt.Sprintf("must be less than a third of LeafDuration (%s)", o.LeafDuration)))
+	}
+	// Stapled OCSP responses are refreshed after half their validity, and
+	// should not outlive the certificate
+	if o.OCSP.Staple && o.OCSP.ResponseDuration > o.LeafDuration {
+		allErrs = append(allErrs, field.Invalid(field.NewPath("OCSP", "ResponseDuration"), o.OCSP.ResponseDuration.String(),
+			fmt.Sprintf("must not be greater than LeafDuration (%s) when stapling", o.LeafDuration)))
+	}
+
+	return allErrs
+}
+
+func validateCABundleFormats(fldPath *field.Path, o CABundleOptions, caSecret string) field.ErrorList {
+	var allErrs field.ErrorList
+
+	// The formats are stored next to the CA in the CA Secret
+	reserved := []string{corev1.TLSCertKey, corev1.TLSPrivateKeyKey, TLSCABundleKey, TLSCRLKey}
+
+	if o.DERKeyPrefix != "" {
+		derPath := fldPath.Child("DERKeyPrefix")
+		allErrs = append(allErrs, validateName(derPath, o.derKey(0), validation.IsConfigMapKey, true)...)
+		for _, key := range reserved {
+			if o.isDERKey(key) {
+				allErrs = append(allErrs, field.Invalid(derPath, o.DERKeyPrefix, fmt.Sprintf("must not match the reserved key %s", key)))
+			}
+		}
+	}
+
+	var keys []string
+	for _, ts := range []struct {
+		path *field.Path
+		opts *TrustStoreOptions
+	}{
+		{fldPath.Child("PKCS12"), o.PKCS12},
+		{fldPath.Child("JKS"), o.JKS},
+	} {
+		if ts.opts == nil {
+			continue
+		}
+		keyPath := ts.path.Child("Key")
+		allErrs = append(allErrs, validateName(keyPath, ts.opts.Key, validation.IsConfigMapKey, true)...)
+		switch {
+		case slices.Contains(reserved, ts.opts.Key):
+			allErrs = append(allErrs, field.Invalid(keyPath, ts.opts.Key, "must not be a reserved key"))
+		case slices.Contains(keys, ts.opts.Key), o.isDERKey(ts.opts.Key):
+			allErrs = append(allErrs, field.Duplicate(keyPath, ts.opts.Key))
+		}
+		keys = append(keys, ts.opts.Key)
+
+		if ref := ts.opts.PasswordSecretRef; ref != nil {
+			refPath := ts.path.Child("PasswordSecretRef")
+			allErrs = append(allErrs, validateName(refPath.Child("Name"), ref.Name, validation.IsDNS1123Subdomain, true)...)
+			allErrs = append(allErrs, validateName(refPath.Child("Key"), ref.Key, validation.IsConfigMapKey, true)...)
+			if ref.Name == caSecret {
+				allErrs = append(allErrs, field.Invalid(refPath.Child("Name"), ref.Name, "must differ from CASecret"))
+			}
+		}
+	}
+
+	return allErrs
+}
+
+func validateDNSNames(fldPath *field.Path, dnsNames []string) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, dnsName := range dnsNames {
+		isValid := validation.IsDNS1123Subdomain
+		if strings.HasPrefix(dnsName, "*.") {
+			isValid = validation.IsWildcardDNS1123Subdomain
+		}
+		for _, msg := range isValid(dnsName) {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), dnsName, msg))
+		}
+	}
+	return allErrs
+}
+
+func validateIPAddresses(fldPath *field.Path, ips []net.IP) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, ip := range ips {
+		if ip.To16() == nil {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), ip.String(), "must be a valid IPv4 or IPv6 address"))
+		} else if ip.IsUnspecified() {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), ip.String(), "must not be an unspecified address"))
+		}
+	}
+	return allErrs
+}
+
+func validateURIs(fldPath *field.Path, uris []*url.URL) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, uri := range uris {
+		switch {
+		case uri == nil:
+			allErrs = append(allErrs, field.Required(fldPath.Index(i), ""))
+		case !uri.IsAbs() || (uri.Host == "" && uri.Opaque == ""):
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), uri.String(), "must be an absolute URI"))
+		}
+	}
+	return allErrs
+}
+
+func validateEmailAddresses(fldPath *field.Path, emailAddresses []string) field.ErrorList {
+	var allErrs field.ErrorList
+	for i, emailAddress := range emailAddresses {
+		// Only a bare address is valid, not one with a display name
+		if addr, err := mail.ParseAddress(emailAddress); err != nil || addr.Address != emailAddress {
+			allErrs = append(allErrs, field.Invalid(fldPath.Index(i), emailAddress, "must be a valid email address"))
+		}
+	}
+	return allErrs
+}
+
+func validateInjectables(fldPath *field.Path, injectables []Injectable) field.ErrorList {
+	var allErrs field.ErrorList
+	seen := map[schema.GroupVersionKind]bool{}
+	for i, injectable := range injectables {
+		if injectable == nil {
+			allErrs = append(allErrs, field.Required(fldPath.Index(i), ""))
+			continue
+		}
+		gvk := injectable.GroupVersionKind()
+		if seen[gvk] {
+			allErrs = append(allErrs, field.Duplicate(fldPath.Index(i), gvk.String()))
+			continue
+		}
+		seen[gvk] = true
+	}
+	return allErrs
+}
@@ -0,0 +1,110 @@
+package authority
+
+import (
+	"crypto/x509"
+	"net"
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+var _ = Describe("Options", func() {
+	validOptions := func() Options {
+		return Options{
+			Namespace: "cert-manager",
+			CASecret:  "ca-cert",
+			DNSNames:  []string{"webhook.cert-manager.svc"},
+		}
+	}
+
+	It("should accept valid options", func() {
+		Expect(validOptions().Validate()).To(Succeed())
+
+		opts := validOptions()
+		opts.IPAddresses = []net.IP{net.IPv4(10, 0, 0, 1), net.ParseIP("fd00::1")}
+		opts.URIs = []*url.URL{{Scheme: "spiffe", Host: "cluster.local", Path: "/ns/cert-manager/sa/webhook"}}
+		opts.EmailAddresses = []string{"webhook@example.com"}
+		Expect(opts.Validate()).To(Succeed())
+	})
+
+	DescribeTable("should reject invalid options",
+		func(mutate func(o *Options), field string) {
+			opts := validOptions()
+			mutate(&opts)
+			Expect(opts.Validate()).To(MatchError(ContainSubstring(field)))
+		},
+		Entry("missing namespace", func(o *Options) { o.Namespace = "" }, "Namespace: Required value"),
+		Entry("invalid namespace", func(o *Options) { o.Namespace = "cert.manager" }, "Namespace: Invalid value"),
+		Entry("missing CA secret", func(o *Options) { o.CASecret = "" }, "CASecret: Required value"),
+		Entry("invalid CA secret", func(o *Options) { o.CASecret = "CA" }, "CASecret: Invalid value"),
+		Entry("client CA secret same as CA secret", func(o *Options) { o.ClientCASecret = o.CASecret }, "ClientCASecret: Invalid value"),
+		Entry("missing subject alternative names", func(o *Options) { o.DNSNames = nil }, "DNSNames: Required value"),
+		Entry("invalid DNS name", func(o *Options) { o.DNSNames = []string{"foo_bar"} }, "DNSNames[0]: Invalid value"),
+		Entry("invalid IP address", func(o *Options) { o.IPAddresses = []net.IP{{10, 0, 0}} }, "IPAddresses[0]: Invalid value"),
+		Entry("unspecified IP address", func(o *Options) { o.IPAddresses = []net.IP{net.IPv4zero} }, "IPAddresses[0]: Invalid value"),
+		Entry("relative URI", func(o *Options) { o.URIs = []*url.URL{{Path: "/ns/foo/sa/bar"}} }, "URIs[0]: Invalid value"),
+		Entry("nil URI", func(o *Options) { o.URIs = []*url.URL{nil} }, "URIs[0]: Required value"),
+		Entry("invalid email address", func(o *Options) { o.EmailAddresses = []string{"Webhook <webhook@example.com>"} }, "EmailAddresses[0]: Invalid value"),
+		Entry("negative duration", func(o *Options) { o.CRLDuration = -time.Hour }, "CRLDuration: Invalid value"),
+		Entry("backdate exceeding leaf duration", func(o *Options) { o.NotBeforeBackdate = 24 * time.Hour }, "NotBeforeBackdate: Invalid value"),
+		Entry("backdate exceeding leaf renewal slack", func(o *Options) { o.NotBeforeBackdate = 8 * time.Hour }, "NotBeforeBackdate: Invalid value"),
+		Entry("invalid CA bundle size", func(o *Options) { o.CABundle.MaxCertificates = -1 }, "CABundle.MaxCertificates: Invalid value"),
+		Entry("truststore without key", func(o *Options) { o.CABundle.PKCS12 = &TrustStoreOptions{} }, "CABundle.PKCS12.Key: Required value"),
+		Entry("truststore with reserved key", func(o *Options) {
+			o.CABundle.JKS = &TrustStoreOptions{Key: TLSCABundleKey}
+		}, "CABundle.JKS.Key: Invalid value"),
+		Entry("truststores with the same key", func(o *Options) {
+			o.CABundle.PKCS12 = &TrustStoreOptions{Key: "truststore"}
+			o.CABundle.JKS = &TrustStoreOptions{Key: "truststore"}
+		}, "CABundle.JKS.Key: Duplicate value"),
+		Entry("truststore key matching DER keys", func(o *Options) {
+			o.CABundle.DERKeyPrefix = "ca-"
+			o.CABundle.PKCS12 = &TrustStoreOptions{Key: "ca-1.der"}
+		}, "CABundle.PKCS12.Key: Duplicate value"),
+		Entry("truststore password in CA secret", func(o *Options) {
+			o.CABundle.PKCS12 = &TrustStoreOptions{Key: "truststore.p12", PasswordSecretRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: o.CASecret},
+				Key:                  "password",
+			}}
+		}, "CABundle.PKCS12.PasswordSecretRef.Name: Invalid value"),
+		Entry("invalid DER key prefix", func(o *Options) { o.CABundle.DERKeyPrefix = "ca/" }, "CABundle.DERKeyPrefix: Invalid value"),
+		Entry("unknown lint rule", func(o *Options) {
+			o.Lint.Severities = map[LintRule]LintSeverity{"Unknown": LintSeverityWarning}
+		}, "Lint.Severities[Unknown]: Unsupported value"),
+		Entry("leaf outliving CA", func(o *Options) { o.CADuration = time.Hour }, "LeafDuration: Invalid value"),
+		Entry("leaf renewal after CA rotation", func(o *Options) { o.CADuration = 36 * time.Hour }, "LeafDuration: Invalid value"),
+		Entry("staple outliving leaf", func(o *Options) {
+			o.OCSP.Staple = true
+			o.OCSP.ResponseDuration = 48 * time.Hour
+		}, "OCSP.ResponseDuration: Invalid value"),
+		Entry("invalid OCSP responder URL", func(o *Options) { o.OCSP.ResponderURL = "/ocsp" }, "OCSP.ResponderURL: Invalid value"),
+		Entry("SNI certificate without DNS names", func(o *Options) {
+			o.SNICertificates = []SNICertificate{{}}
+		}, "SNICertificates[0].DNSNames: Required value"),
+		Entry("unsupported SNI key algorithm", func(o *Options) {
+			o.SNICertificates = []SNICertificate{{DNSNames: []string{"*.example.com"}, KeyAlgorithm: x509.DSA}}
+		}, "SNICertificates[0].KeyAlgorithm: Unsupported value"),
+		Entry("invalid Pod identity", func(o *Options) { o.Pod = &PodIdentity{Name: "operator-0"} }, "Pod.Namespace: Required value"),
+		Entry("invalid Pod IP", func(o *Options) {
+			o.Pod = &PodIdentity{Name: "operator-0", Namespace: "cert-manager", IPs: []net.IP{{1}}}
+		}, "Pod.IPs[0]: Invalid value"),
+		Entry("negative discovery interval", func(o *Options) { o.InjectableDiscoveryInterval = -time.Second }, "InjectableDiscoveryInterval: Invalid value"),
+		Entry("duplicate injectables", func(o *Options) {
+			o.Injectables = []Injectable{&ValidatingWebhookCaBundleInject{}, &ValidatingWebhookCaBundleInject{}}
+		}, "Injectables[1]: Duplicate value"),
+	)
+
+	It("should aggregate errors", func() {
+		err := Options{CADuration: time.Hour}.Validate()
+		Expect(err).To(MatchError(And(
+			ContainSubstring("Namespace"),
+			ContainSubstring("CASecret"),
+			ContainSubstring("DNSNames"),
+			ContainSubstring("LeafDuration"),
+		)))
+	})
+})
@@ -0,0 +1,115 @@
+package authority
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+)
+
+const (
+	// PodNameEnvVar is the environment variable PodIdentityFromEnv reads the
+	// Pod name from. It should be set using the downward API.
+	PodNameEnvVar = "POD_NAME"
+	// PodNamespaceEnvVar is the environment variable PodIdentityFromEnv reads
+	// the Pod namespace from. It should be set using the downward API.
+	PodNamespaceEnvVar = "POD_NAMESPACE"
+	// PodIPsEnvVar is the environment variable PodIdentityFromEnv reads the
+	// comma separated Pod IPs from. It should be set using the downward API,
+	// from status.podIPs. PodIPEnvVar is used if this is not set.
+	PodIPsEnvVar = "POD_IPS"
+	// PodIPEnvVar is the environment variable PodIdentityFromEnv reads the
+	// Pod IP from. It should be set using the downward API, from status.podIP.
+	PodIPEnvVar = "POD_IP"
+	// PodSubdomainEnvVar is the optional environment variable
+	// PodIdentityFromEnv reads the subdomain of the Pod from. It should be
+	// set to the spec.subdomain of the Pod, i.e. the name of its headless
+	// Service, which isn't available from the downward API.
+	PodSubdomainEnvVar = "POD_SUBDOMAIN"
+)
+
+// PodIdentity identifies the Pod of an operator replica.
+type PodIdentity struct {
+	Name      string
+	Namespace string
+	IPs       []net.IP
+
+	// The subdomain of the Pod, i.e. the name of the headless Service
+	// governing it, e.g. of a StatefulSet. Its hostname is assumed to be its
+	// name, as for StatefulSets.
+	Subdomain string
+
+	// The DNS domain of the cluster. Defaults to DefaultClusterDomain.
+	ClusterDomain string
+}
+
+// PodIdentityFromEnv returns the PodIdentity of the current Pod, read from
+// environment variables set using the downward API.
+func PodIdentityFromEnv() (*PodIdentity, error) {
+	pod := &PodIdentity{
+		Name:      os.Getenv(PodNameEnvVar),
+		Namespace: os.Getenv(PodNamespaceEnvVar),
+		Subdomain: os.Getenv(PodSubdomainEnvVar),
+	}
+	if pod.Name == "" || pod.Namespace == "" {
+		return nil, fmt.Errorf("environment variables %s and %s must be set", PodNameEnvVar, PodNamespaceEnvVar)
+	}
+
+	podIPs := os.Getenv(PodIPsEnvVar)
+	if podIPs == "" {
+		podIPs = os.Getenv(PodIPEnvVar)
+	}
+	for _, podIP := range strings.Split(podIPs, ",") {
+		if podIP == "" {
+			continue
+		}
+		ip := net.ParseIP(strings.TrimSpace(podIP))
+		if ip == nil {
+			return nil, fmt.Errorf("invalid Pod IP %q", podIP)
+		}
+		pod.IPs = append(pod.IPs, ip)
+	}
+
+	return pod, nil
+}
+
+// DNSNames returns the DNS names identifying the Pod: the Pod name, the
+// <name>.<subdomain>.<namespace>.svc and <name>.<subdomain>.<namespace>.svc.<cluster domain>
+// names if it has a subdomain, and the IP based <ip>.<namespace>.pod and
+// <ip>.<namespace>.pod.<cluster domain> names for each Pod IP.
+func (p *PodIdentity) DNSNames() []string {
+	clusterDomain := p.ClusterDomain
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+
+	dnsNames := []string{p.Name}
+	if p.Subdomain != "" {
+		hostname := p.Name + "." + p.Subdomain + "." + p.Namespace + ".svc"
+		dnsNames = append(dnsNames, hostname, hostname+"."+clusterDomain)
+	}
+	for _, ip := range p.IPs {
+		dashed := strings.NewReplacer(".", "-", ":", "-").Replace(ip.String())
+		dnsNames = append(dnsNames,
+			dashed+"."+p.Namespace+".pod",
+			dashed+"."+p.Namespace+".pod."+clusterDomain,
+		)
+	}
+	return dnsNames
+}
+
+// servingCertificateAnnotations returns the ApplyConfiguration annotating
+// the Pod with the serial number and fingerprint of its serving certificate.
+func (p *PodIdentity) servingCertificateAnnotations(cert *x509.Certificate) *corev1ac.PodApplyConfiguration {
+	fingerprint := sha256.Sum256(cert.Raw)
+	return corev1ac.Pod(p.Name, p.Namespace).
+		WithAnnotations(map[string]string{
+			ServingCertificateSerialAnnotation:      cert.SerialNumber.Text(16),
+			ServingCertificateFingerprintAnnotation: hex.EncodeToString(fingerprint[:]),
+		})
+}
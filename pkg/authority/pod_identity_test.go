@@ -0,0 +1,46 @@
+package authority
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Pod Identity", func() {
+	It("should read Pod identity from environment", func() {
+		GinkgoT().Setenv(PodNameEnvVar, "operator-0")
+		GinkgoT().Setenv(PodNamespaceEnvVar, "operator")
+		GinkgoT().Setenv(PodIPsEnvVar, "10.1.2.3,fd00::1")
+		GinkgoT().Setenv(PodSubdomainEnvVar, "operator-headless")
+
+		pod, err := PodIdentityFromEnv()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(pod.Name).To(Equal("operator-0"))
+		Expect(pod.Namespace).To(Equal("operator"))
+		Expect(pod.IPs).To(HaveExactElements(net.ParseIP("10.1.2.3"), net.ParseIP("fd00::1")))
+		Expect(pod.Subdomain).To(Equal("operator-headless"))
+		Expect(pod.DNSNames()).To(Equal([]string{
+			"operator-0",
+			"operator-0.operator-headless.operator.svc",
+			"operator-0.operator-headless.operator.svc.cluster.local",
+			"10-1-2-3.operator.pod",
+			"10-1-2-3.operator.pod.cluster.local",
+			"fd00--1.operator.pod",
+			"fd00--1.operator.pod.cluster.local",
+		}))
+	})
+
+	It("should only include the subdomain DNS names with a subdomain", func() {
+		pod := &PodIdentity{Name: "operator-0", Namespace: "operator", ClusterDomain: "example.org"}
+		Expect(pod.DNSNames()).To(Equal([]string{"operator-0"}))
+	})
+
+	It("should fail if Pod name is not set", func() {
+		GinkgoT().Setenv(PodNameEnvVar, "")
+		GinkgoT().Setenv(PodNamespaceEnvVar, "operator")
+
+		_, err := PodIdentityFromEnv()
+		Expect(err).To(MatchError(ContainSubstring(PodNameEnvVar)))
+	})
+})
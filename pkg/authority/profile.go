@@ -0,0 +1,178 @@
+package authority
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// SANType is a type of subject alternative name.
+type SANType string
+
+const (
+	SANTypeDNS   SANType = "DNS"
+	SANTypeIP    SANType = "IP"
+	SANTypeURI   SANType = "URI"
+	SANTypeEmail SANType = "Email"
+)
+
+// CertificateProfile describes a kind of certificate issued by the authority:
+// its usages, duration and required subject alternative names. All
+// certificates issued by the authority itself use a profile, so certificates
+// of the same kind are consistent regardless of how they are issued.
+type CertificateProfile struct {
+	// The name of the profile, e.g. for logging.
+	Name string
+
+	// If set, the certificate is a CA.
+	IsCA bool
+
+	// The key usages of the certificate. If not set, they are derived from
+	// the extended key usages and the key algorithm.
+	KeyUsage x509.KeyUsage
+
+	// The extended key usages of the certificate.
+	ExtKeyUsage []x509.ExtKeyUsage
+
+	// The amount of time the certificate is valid for. Defaults to
+	// Options.LeafDuration, or Options.CADuration for CAs.
+	Duration time.Duration
+
+	// The types of subject alternative names the certificate must have at
+	// least one of. If empty, no subject alternative name is required.
+	RequiredSANTypes []SANType
+}
+
+// ServerProfile returns the profile of serving certificates.
+func ServerProfile() CertificateProfile {
+	return CertificateProfile{
+		Name:             "server",
+		ExtKeyUsage:      []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		RequiredSANTypes: []SANType{SANTypeDNS, SANTypeIP, SANTypeURI},
+	}
+}
+
+// ClientProfile returns the profile of client certificates, identified by
+// their subject.
+func ClientProfile() CertificateProfile {
+	return CertificateProfile{
+		Name:        "client",
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+}
+
+// PeerProfile returns the profile of certificates used both to serve and to
+// authenticate as a client, e.g. between replicas of a cluster.
+func PeerProfile() CertificateProfile {
+	return CertificateProfile{
+		Name:             "peer",
+		ExtKeyUsage:      []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		RequiredSANTypes: []SANType{SANTypeDNS, SANTypeIP, SANTypeURI},
+	}
+}
+
+// CAProfile returns the profile of the dynamic CA.
+func CAProfile() CertificateProfile {
+	return CertificateProfile{
+		Name: "ca",
+		IsCA: true,
+	}
+}
+
+// ocspResponderProfile returns the profile of delegated OCSP responder
+// certificates.
+func ocspResponderProfile() CertificateProfile {
+	return CertificateProfile{
+		Name:        "ocsp-responder",
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}
+}
+
+// templateProfile returns the profile of certificates signed for a template
+// by Sign and SignCSR: the profile with the extended key usages of the
+// template, or else a custom profile. The key usages of the template are
+// kept, if any.
+func templateProfile(template *x509.Certificate) CertificateProfile {
+	if len(template.ExtKeyUsage) > 0 {
+		for _, profile := range []CertificateProfile{ServerProfile(), ClientProfile(), PeerProfile()} {
+			if slices.Equal(template.ExtKeyUsage, profile.ExtKeyUsage) {
+				profile.KeyUsage = template.KeyUsage
+				return profile
+			}
+		}
+	}
+	return CertificateProfile{
+		Name:        "custom",
+		IsCA:        template.IsCA,
+		KeyUsage:    template.KeyUsage,
+		ExtKeyUsage: template.ExtKeyUsage,
+	}
+}
+
+// duration returns the amount of time certificates of the profile are valid
+// for.
+func (p CertificateProfile) duration(opts Options) time.Duration {
+	switch {
+	case p.Duration > 0:
+		return p.Duration
+	case p.IsCA:
+		return opts.CADuration
+	default:
+		return opts.LeafDuration
+	}
+}
+
+// keyUsage returns the key usages of certificates of the profile for the
+// given public key.
+func (p CertificateProfile) keyUsage(publicKey any) x509.KeyUsage {
+	if p.KeyUsage != 0 {
+		return p.KeyUsage
+	}
+	if p.IsCA {
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	usage := x509.KeyUsageDigitalSignature
+	// Only RSA keys can be used for key encipherment, i.e. TLS 1.2 RSA key
+	// exchange by servers; strict clients reject it for other key types
+	if _, ok := publicKey.(*rsa.PublicKey); ok && slices.Contains(p.ExtKeyUsage, x509.ExtKeyUsageServerAuth) {
+		usage |= x509.KeyUsageKeyEncipherment
+	}
+	return usage
+}
+
+// apply sets the usages of the profile on the template, and verifies it has
+// the required subject alternative names.
+func (p CertificateProfile) apply(template *x509.Certificate) error {
+	if p.Duration < 0 {
+		return fmt.Errorf("invalid duration %s of certificate profile %s", p.Duration, p.Name)
+	}
+	if len(p.RequiredSANTypes) > 0 && !slices.ContainsFunc(p.RequiredSANTypes, func(t SANType) bool {
+		return hasSANType(template, t)
+	}) {
+		return fmt.Errorf("%s certificate requires a subject alternative name of type %v", p.Name, p.RequiredSANTypes)
+	}
+
+	template.Version = 3
+	template.BasicConstraintsValid = true
+	template.IsCA = p.IsCA
+	template.KeyUsage = p.keyUsage(template.PublicKey)
+	template.ExtKeyUsage = slices.Clone(p.ExtKeyUsage)
+	return nil
+}
+
+func hasSANType(template *x509.Certificate, t SANType) bool {
+	switch t {
+	case SANTypeDNS:
+		return len(template.DNSNames) > 0
+	case SANTypeIP:
+		return len(template.IPAddresses) > 0
+	case SANTypeURI:
+		return len(template.URIs) > 0
+	case SANTypeEmail:
+		return len(template.EmailAddresses) > 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,113 @@
+package authority
+
+import (
+	"crypto/x509"
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+var _ = Describe("Certificate profiles", func() {
+	DescribeTable("should set usages by key algorithm",
+		func(profile CertificateProfile, keyAlgorithm x509.PublicKeyAlgorithm, keyUsage x509.KeyUsage) {
+			pk, err := pki.GeneratePrivateKey(keyAlgorithm)
+			Expect(err).ToNot(HaveOccurred())
+			template := &x509.Certificate{DNSNames: []string{"example.com"}, PublicKey: pk.Public()}
+			Expect(profile.apply(template)).To(Succeed())
+			Expect(template.KeyUsage).To(Equal(keyUsage))
+			Expect(template.ExtKeyUsage).To(Equal(profile.ExtKeyUsage))
+			Expect(template.IsCA).To(Equal(profile.IsCA))
+		},
+		Entry("server with ECDSA key", ServerProfile(), x509.ECDSA, x509.KeyUsageDigitalSignature),
+		Entry("server with RSA key", ServerProfile(), x509.RSA, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment),
+		Entry("server with Ed25519 key", ServerProfile(), x509.Ed25519, x509.KeyUsageDigitalSignature),
+		Entry("client with RSA key", ClientProfile(), x509.RSA, x509.KeyUsageDigitalSignature),
+		Entry("peer with RSA key", PeerProfile(), x509.RSA, x509.KeyUsageDigitalSignature|x509.KeyUsageKeyEncipherment),
+		Entry("CA", CAProfile(), x509.ECDSA, x509.KeyUsageDigitalSignature|x509.KeyUsageCertSign|x509.KeyUsageCRLSign),
+	)
+
+	It("should require subject alternative names", func() {
+		Expect(ServerProfile().apply(&x509.Certificate{})).To(MatchError(ContainSubstring("server certificate requires a subject alternative name")))
+		Expect(PeerProfile().apply(&x509.Certificate{IPAddresses: []net.IP{net.ParseIP("10.0.0.1")}})).To(Succeed())
+		Expect(ClientProfile().apply(&x509.Certificate{})).To(Succeed())
+	})
+
+	It("should default durations", func() {
+		opts := Options{CADuration: 7 * 24 * time.Hour, LeafDuration: 24 * time.Hour}
+		Expect(ServerProfile().duration(opts)).To(Equal(opts.LeafDuration))
+		Expect(CAProfile().duration(opts)).To(Equal(opts.CADuration))
+		profile := ClientProfile()
+		profile.Duration = time.Hour
+		Expect(profile.duration(opts)).To(Equal(time.Hour))
+	})
+
+	It("should return a fresh profile", func() {
+		profile := PeerProfile()
+		profile.ExtKeyUsage[0] = x509.ExtKeyUsageCodeSigning
+		Expect(PeerProfile().ExtKeyUsage).To(Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}))
+	})
+
+	It("should select the profile of the extended key usages of the template", func() {
+		Expect(templateProfile(&x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}})).To(HaveField("Name", "server"))
+		Expect(templateProfile(&x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}})).To(HaveField("Name", "peer"))
+		Expect(templateProfile(&x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}})).To(HaveField("Name", "custom"))
+		Expect(templateProfile(&x509.Certificate{})).To(HaveField("Name", "custom"))
+
+		template := &x509.Certificate{
+			KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		Expect(templateProfile(template).apply(template)).To(Succeed())
+		Expect(template.KeyUsage).To(Equal(x509.KeyUsageDigitalSignature|x509.KeyUsageKeyAgreement), "the usages of the template are kept")
+		Expect(templateProfile(&x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}).apply(&x509.Certificate{
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})).To(MatchError(ContainSubstring("requires a subject alternative name")))
+	})
+
+	It("should sign with the usages of the template in a custom profile", func() {
+		opts := Options{CADuration: 7 * 24 * time.Hour, LeafDuration: 24 * time.Hour}
+		caCert, caPK, err := GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caPkBytes, err := pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+		pk, err := pki.GenerateECPrivateKey(pki.ECCurve256)
+		Expect(err).ToNot(HaveOccurred())
+
+		cert, err := Sign(opts, &x509.Certificate{
+			PublicKey:   pk.Public(),
+			KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement,
+			ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		}, caCertBytes, caPkBytes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cert.KeyUsage).To(Equal(x509.KeyUsageDigitalSignature | x509.KeyUsageKeyAgreement))
+		Expect(cert.ExtKeyUsage).To(Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}))
+		Expect(cert.IsCA).To(BeFalse())
+	})
+
+	It("should issue certificates of the profile", func() {
+		opts := Options{CADuration: 7 * 24 * time.Hour, LeafDuration: 24 * time.Hour}
+		caCert, caPK, err := GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(caCert.KeyUsage).To(Equal(CAProfile().keyUsage(caCert.PublicKey)))
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caPkBytes, err := pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		r := reconciler{Opts: opts}
+		profile := PeerProfile()
+		profile.Duration = time.Hour
+		certData, _, err := r.issueLeaf(ctx, profile, &x509.Certificate{DNSNames: []string{"peer.example.com"}}, x509.ECDSA, caCertBytes, caPkBytes)
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := pki.DecodeX509CertificateBytes(certData)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cert.ExtKeyUsage).To(Equal(PeerProfile().ExtKeyUsage))
+		Expect(cert.NotAfter.Sub(cert.NotBefore)).To(Equal(time.Hour))
+	})
+})
@@ -1,7 +1,12 @@
 package authority
 
 import (
+	"errors"
+
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
@@ -12,16 +17,74 @@ import (
 
 type reconciler struct {
 	client.Client
-	Cache cache.Cache
-	Opts  Options
+	// APIReader reads objects not in Cache, defaulting to Client.
+	APIReader client.Reader
+	Cache     cache.Cache
+	Recorder  record.EventRecorder
+	Opts      Options
+}
+
+// handleError decides how an error reconciling obj is handled. Errors caused
+// by invalid data, a refused injection or a certificate failing linting
+// can't be resolved by retrying; they are recorded as a warning Event on obj
+// and returned as terminal errors, leaving obj alone until it or the CA
+// Secret changes. Other errors, e.g. an expired CA pending rotation or a
+// transient API error, are retried with backoff.
+func (r reconciler) handleError(obj runtime.Object, err error) error {
+	var reason string
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrInvalidData):
+		reason = "InvalidData"
+	case errors.Is(err, ErrKeyMismatch):
+		reason = "KeyMismatch"
+	case errors.Is(err, ErrInjectionRefused):
+		reason = "InjectionRefused"
+	case errors.Is(err, ErrLintFailed):
+		reason = "LintFailed"
+	case errors.Is(err, ErrCAExpired):
+		r.event(obj, "CAExpired", err)
+		return err
+	default:
+		return err
+	}
+	r.event(obj, reason, err)
+	return reconcile.TerminalError(err)
+}
+
+func (r reconciler) event(obj runtime.Object, reason string, err error) {
+	if r.Recorder != nil {
+		r.Recorder.Event(obj, corev1.EventTypeWarning, reason, err.Error())
+	}
+}
+
+// newSecret returns a Secret referring to the Secret with the given name,
+// e.g. to record Events for.
+func newSecret(key types.NamespacedName) *corev1.Secret {
+	secret := &corev1.Secret{}
+	secret.Namespace = key.Namespace
+	secret.Name = key.Name
+	return secret
 }
 
 func (r reconciler) caSecretSource(handler handler.TypedEventHandler[*corev1.Secret, reconcile.Request]) source.SyncingSource {
+	return r.secretSource(r.Opts.CASecret, handler)
+}
+
+func (r reconciler) secretSource(name string, handler handler.TypedEventHandler[*corev1.Secret, reconcile.Request]) source.SyncingSource {
 	return source.Kind(
 		r.Cache,
 		&corev1.Secret{},
 		handler,
 		predicate.NewTypedPredicateFuncs[*corev1.Secret](func(obj *corev1.Secret) bool {
-			return obj.Namespace == r.Opts.Namespace && obj.Name == r.Opts.CASecret
+			return obj.Namespace == r.Opts.Namespace && obj.Name == name
 		}))
 }
+
+func (r reconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
@@ -0,0 +1,149 @@
+package authority
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Render generates a CA Secret in the layout maintained by the dynamic
+// authority, and returns copies of the given manifests with its CA bundle
+// injected, for installing them before the dynamic authority is running.
+// Otherwise, webhooks are unusable until their CA bundle is injected, which
+// blocks all requests matched by webhooks failing closed.
+//
+// The CA bundle is injected into webhook configurations, CRDs using a
+// conversion webhook and APIServices, which are labelled to want injection
+// from the CA Secret. Other manifests are returned unchanged. The dynamic
+// authority adopts the rendered CA, and rotates it when due. Only resources
+// of the kinds in Options.Injectables are kept up to date after rotation.
+//
+// Every call generates a new CA, so the rendered Secret must only be created
+// once, e.g. using the Helm lookup function to render an existing Secret
+// unchanged, or the "helm.sh/resource-policy: keep" annotation. Applying a
+// re-rendered Secret replaces the CA bundle with one lacking the CA in use,
+// and serving certificates aren't trusted until they are reissued.
+//
+// Truststores of the CA bundle using a password Secret are not rendered, and
+// are added by the dynamic authority when it adopts the CA.
+func Render(ctx context.Context, opts Options, manifests []*unstructured.Unstructured) (*corev1.Secret, []*unstructured.Unstructured, error) {
+	opts.setDefaults()
+	if err := opts.validateCA().ToAggregate(); err != nil {
+		return nil, nil, err
+	}
+
+	r := &CASecretReconciler{reconciler: reconciler{Opts: opts}}
+	cert, pk, err := GenerateCA(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := r.lint(ctx, cert, cert); err != nil {
+		return nil, nil, err
+	}
+
+	secret := newSecret(types.NamespacedName{Namespace: opts.Namespace, Name: opts.CASecret})
+	data, _, _, err := r.caSecretData(ctx, secret, cert, pk)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Truststores using a password Secret are encoded by the dynamic
+	// authority when it adopts the CA
+	offline := *r
+	for _, ts := range []**TrustStoreOptions{&offline.Opts.CABundle.PKCS12, &offline.Opts.CABundle.JKS} {
+		if *ts != nil && (*ts).PasswordSecretRef != nil {
+			*ts = nil
+		}
+	}
+	formats, err := offline.encodeCABundleFormats(ctx, data[TLSCABundleKey])
+	if err != nil {
+		return nil, nil, err
+	}
+	maps.Copy(data, formats)
+
+	// The Secret is rendered from the ApplyConfiguration the dynamic
+	// authority applies, so it finds the Secret it maintains
+	acBytes, err := json.Marshal(caSecretApplyConfiguration(secret, data))
+	if err != nil {
+		return nil, nil, err
+	}
+	secret = &corev1.Secret{}
+	if err := json.Unmarshal(acBytes, secret); err != nil {
+		return nil, nil, err
+	}
+
+	rendered := make([]*unstructured.Unstructured, 0, len(manifests))
+	for _, obj := range manifests {
+		obj = obj.DeepCopy()
+		if err := injectManifest(obj, types.NamespacedName{Namespace: opts.Namespace, Name: opts.CASecret}, data[TLSCABundleKey]); err != nil {
+			return nil, nil, fmt.Errorf("failed injecting CA bundle into %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		rendered = append(rendered, obj)
+	}
+	return secret, rendered, nil
+}
+
+// injectManifest sets the CA bundle of obj, and labels it to want injection
+// from the CA Secret, if it is a kind of resource supported by Render.
+func injectManifest(obj *unstructured.Unstructured, caSecret types.NamespacedName, caBundle []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(caBundle)
+	gk := obj.GroupVersionKind().GroupKind()
+	switch gk {
+	case schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"},
+		schema.GroupKind{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:
+		webhooks, _, err := unstructured.NestedSlice(obj.Object, "webhooks")
+		if err != nil {
+			return err
+		}
+		for i, w := range webhooks {
+			webhook, ok := w.(map[string]any)
+			if !ok {
+				return fmt.Errorf("invalid webhook at index %d", i)
+			}
+			if err := unstructured.SetNestedField(webhook, encoded, "clientConfig", "caBundle"); err != nil {
+				return err
+			}
+		}
+		if err := unstructured.SetNestedSlice(obj.Object, webhooks, "webhooks"); err != nil {
+			return err
+		}
+
+	case schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:
+		strategy, _, err := unstructured.NestedString(obj.Object, "spec", "conversion", "strategy")
+		if err != nil || strategy != "Webhook" {
+			return err
+		}
+		if err := unstructured.SetNestedField(obj.Object, encoded, "spec", "conversion", "webhook", "clientConfig", "caBundle"); err != nil {
+			return err
+		}
+
+	case schema.GroupKind{Group: "apiregistration.k8s.io", Kind: "APIService"}:
+		// Local APIServices are served by the API server itself
+		service, _, err := unstructured.NestedMap(obj.Object, "spec", "service")
+		if err != nil || service == nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(obj.Object, encoded, "spec", "caBundle"); err != nil {
+			return err
+		}
+
+	default:
+		return nil
+	}
+
+	// The dynamic authority keeps the CA bundle up to date after rotation
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[WantInjectFromSecretNamespaceLabel] = caSecret.Namespace
+	labels[WantInjectFromSecretNameLabel] = caSecret.Name
+	obj.SetLabels(labels)
+	return nil
+}
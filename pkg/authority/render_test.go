@@ -0,0 +1,157 @@
+package authority
+
+import (
+	"encoding/base64"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+	"github.com/erikgb/dynamic-authority/internal/pki/pkitest"
+)
+
+var _ = Describe("Render", func() {
+	var opts Options
+
+	BeforeEach(func() {
+		opts = Options{
+			Namespace:  "cert-manager",
+			CASecret:   "ca-cert",
+			CADuration: 7 * 24 * time.Hour,
+		}
+	})
+
+	toUnstructured := func(obj runtime.Object) *unstructured.Unstructured {
+		GinkgoHelper()
+		u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		Expect(err).ToNot(HaveOccurred())
+		return &unstructured.Unstructured{Object: u}
+	}
+
+	It("should render a CA Secret adopted by the CA Secret controller", func() {
+		secret, _, err := Render(ctx, opts, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.APIVersion).To(Equal("v1"))
+		Expect(secret.Kind).To(Equal("Secret"))
+		Expect(secret.Namespace).To(Equal("cert-manager"))
+		Expect(secret.Name).To(Equal("ca-cert"))
+		Expect(secret.Labels).To(HaveKeyWithValue(DynamicAuthoritySecretLabel, "true"))
+		Expect(secret.Type).To(Equal(corev1.SecretTypeTLS))
+		Expect(secret.Data).To(And(
+			HaveKey(TLSCRLKey),
+			pkitest.HaveKeyPair(corev1.TLSCertKey, corev1.TLSPrivateKeyKey),
+			pkitest.HaveCACertificate(corev1.TLSCertKey),
+			pkitest.HaveCertificateInBundle(corev1.TLSCertKey, TLSCABundleKey),
+		))
+
+		By("adopting the CA and its data unchanged")
+		r := &CASecretReconciler{reconciler: reconciler{Opts: opts}}
+		r.Opts.setDefaults()
+		generate, cert, pk := r.needsGenerate(secret)
+		Expect(generate).To(BeFalse())
+		data, _, _, err := r.caSecretData(ctx, secret, cert, pk)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(secret.Data))
+	})
+
+	It("should render the CA bundle formats not using a password Secret", func() {
+		opts.CABundle = CABundleOptions{
+			PKCS12:       &TrustStoreOptions{Key: "truststore.p12", PasswordSecretRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "password"}, Key: "password"}},
+			DERKeyPrefix: "ca-",
+		}
+		secret, _, err := Render(ctx, opts, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Data).ToNot(HaveKey("truststore.p12"))
+		caCert, err := pki.DecodeX509CertificateBytes(secret.Data[corev1.TLSCertKey])
+		Expect(err).ToNot(HaveOccurred())
+		Expect(secret.Data).To(HaveKeyWithValue("ca-0.der", caCert.Raw))
+	})
+
+	It("should inject the CA bundle into the manifests", func() {
+		vwc := NewValidatingWebhookConfigurationForTest("validating", types.NamespacedName{Namespace: opts.Namespace, Name: opts.CASecret})
+		vwc.SetGroupVersionKind(admissionregistrationv1.SchemeGroupVersion.WithKind("ValidatingWebhookConfiguration"))
+		mwc := &admissionregistrationv1.MutatingWebhookConfiguration{}
+		mwc.SetGroupVersionKind(admissionregistrationv1.SchemeGroupVersion.WithKind("MutatingWebhookConfiguration"))
+		mwc.Name = "mutating"
+		mwc.Webhooks = []admissionregistrationv1.MutatingWebhook{{Name: "foo-webhook.cert-manager.io"}}
+
+		newManifest := func(apiVersion, kind, name string, spec map[string]any) *unstructured.Unstructured {
+			obj := &unstructured.Unstructured{Object: map[string]any{"spec": spec}}
+			obj.SetAPIVersion(apiVersion)
+			obj.SetKind(kind)
+			obj.SetName(name)
+			return obj
+		}
+		conversion := newManifest("apiextensions.k8s.io/v1", "CustomResourceDefinition", "conversion", map[string]any{
+			"conversion": map[string]any{
+				"strategy": "Webhook",
+				"webhook":  map[string]any{"clientConfig": map[string]any{"service": map[string]any{"name": "webhook"}}},
+			},
+		})
+		noConversion := newManifest("apiextensions.k8s.io/v1", "CustomResourceDefinition", "no-conversion", map[string]any{
+			"conversion": map[string]any{"strategy": "None"},
+		})
+		apiService := newManifest("apiregistration.k8s.io/v1", "APIService", "v1.example.com", map[string]any{
+			"service": map[string]any{"name": "api", "namespace": "default"},
+		})
+		localAPIService := newManifest("apiregistration.k8s.io/v1", "APIService", "v1.apps", map[string]any{})
+		configMap := toUnstructured(&corev1.ConfigMap{TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"}, Data: map[string]string{"foo": "bar"}})
+
+		manifests := []*unstructured.Unstructured{
+			toUnstructured(vwc), toUnstructured(mwc), conversion, noConversion, apiService, localAPIService, configMap,
+		}
+		originals := make([]*unstructured.Unstructured, 0, len(manifests))
+		for _, obj := range manifests {
+			originals = append(originals, obj.DeepCopy())
+		}
+
+		secret, rendered, err := Render(ctx, opts, manifests)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(manifests).To(Equal(originals), "the manifests are not modified")
+		Expect(rendered).To(HaveLen(len(manifests)))
+		caBundle := base64.StdEncoding.EncodeToString(secret.Data[TLSCABundleKey])
+
+		caBundleAt := func(obj *unstructured.Unstructured, fields ...string) string {
+			GinkgoHelper()
+			value, _, err := unstructured.NestedString(obj.Object, fields...)
+			Expect(err).ToNot(HaveOccurred())
+			return value
+		}
+		for _, obj := range rendered[:2] {
+			webhooks, _, err := unstructured.NestedSlice(obj.Object, "webhooks")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(webhooks).ToNot(BeEmpty())
+			for _, w := range webhooks {
+				Expect(caBundleAt(&unstructured.Unstructured{Object: w.(map[string]any)}, "clientConfig", "caBundle")).To(Equal(caBundle))
+			}
+		}
+		Expect(caBundleAt(rendered[2], "spec", "conversion", "webhook", "clientConfig", "caBundle")).To(Equal(caBundle))
+		Expect(caBundleAt(rendered[2], "spec", "conversion", "webhook", "clientConfig", "service", "name")).To(Equal("webhook"))
+		Expect(rendered[3]).To(Equal(noConversion))
+		Expect(caBundleAt(rendered[4], "spec", "caBundle")).To(Equal(caBundle))
+		Expect(rendered[5]).To(Equal(localAPIService))
+		Expect(rendered[6]).To(Equal(configMap))
+
+		By("labelling the injected manifests to want injection from the CA Secret")
+		for _, obj := range []*unstructured.Unstructured{rendered[0], rendered[1], rendered[2], rendered[4]} {
+			Expect(obj.GetLabels()).To(And(
+				HaveKeyWithValue(WantInjectFromSecretNamespaceLabel, opts.Namespace),
+				HaveKeyWithValue(WantInjectFromSecretNameLabel, opts.CASecret),
+			), obj.GetName())
+		}
+	})
+
+	It("should refuse invalid options", func() {
+		opts.CASecret = ""
+		_, _, err := Render(ctx, opts, nil)
+		Expect(err).To(MatchError(ContainSubstring("CASecret: Required value")))
+	})
+})
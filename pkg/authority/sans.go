@@ -0,0 +1,84 @@
+package authority
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultClusterDomain is the default DNS domain of Kubernetes clusters.
+const DefaultClusterDomain = "cluster.local"
+
+// ServiceDNSNames returns the DNS names a Service can be reached by from
+// within the cluster: <name>, <name>.<namespace>, <name>.<namespace>.svc and
+// <name>.<namespace>.svc.<cluster domain>.
+// If clusterDomain is empty, DefaultClusterDomain is used.
+func ServiceDNSNames(svc types.NamespacedName, clusterDomain string) []string {
+	if clusterDomain == "" {
+		clusterDomain = DefaultClusterDomain
+	}
+	return []string{
+		svc.Name,
+		svc.Name + "." + svc.Namespace,
+		svc.Name + "." + svc.Namespace + ".svc",
+		svc.Name + "." + svc.Namespace + ".svc." + clusterDomain,
+	}
+}
+
+// +kubebuilder:rbac:groups="",resources=services,verbs=get
+
+// ServiceIPAddresses returns the cluster IPs of a Service.
+// Headless services have no cluster IPs, and will return an empty slice.
+func ServiceIPAddresses(ctx context.Context, c client.Reader, svc types.NamespacedName) ([]net.IP, error) {
+	service := &corev1.Service{}
+	if err := c.Get(ctx, svc, service); err != nil {
+		return nil, err
+	}
+
+	clusterIPs := service.Spec.ClusterIPs
+	if len(clusterIPs) == 0 && service.Spec.ClusterIP != "" {
+		clusterIPs = []string{service.Spec.ClusterIP}
+	}
+
+	var ips []net.IP
+	for _, clusterIP := range clusterIPs {
+		if clusterIP == corev1.ClusterIPNone {
+			continue
+		}
+		ip := net.ParseIP(clusterIP)
+		if ip == nil {
+			return nil, fmt.Errorf("service %s has invalid cluster IP %q", svc, clusterIP)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
+var spiffeTrustDomainRegexp = regexp.MustCompile(`^[a-z0-9._-]+$`)
+
+// SPIFFEID returns the SPIFFE ID of a Kubernetes service account, following
+// the common template spiffe://<trust domain>/ns/<namespace>/sa/<service account>.
+func SPIFFEID(trustDomain, namespace, serviceAccount string) (*url.URL, error) {
+	if len(trustDomain) > 255 || !spiffeTrustDomainRegexp.MatchString(trustDomain) {
+		return nil, fmt.Errorf("invalid SPIFFE trust domain %q", trustDomain)
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid namespace %q: %v", namespace, errs)
+	}
+	if errs := validation.IsDNS1123Subdomain(serviceAccount); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid service account name %q: %v", serviceAccount, errs)
+	}
+
+	return &url.URL{
+		Scheme: "spiffe",
+		Host:   trustDomain,
+		Path:   "/ns/" + namespace + "/sa/" + serviceAccount,
+	}, nil
+}
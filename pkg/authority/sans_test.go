@@ -0,0 +1,53 @@
+package authority
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var _ = Describe("Subject Alternative Names", func() {
+	It("should return service DNS names", func() {
+		svc := types.NamespacedName{Namespace: "foo", Name: "webhook"}
+
+		Expect(ServiceDNSNames(svc, "")).To(Equal([]string{
+			"webhook",
+			"webhook.foo",
+			"webhook.foo.svc",
+			"webhook.foo.svc.cluster.local",
+		}))
+		Expect(ServiceDNSNames(svc, "example.org")).To(ContainElement("webhook.foo.svc.example.org"))
+	})
+
+	It("should return service cluster IPs", func() {
+		ns := &corev1.Namespace{}
+		ns.Name = "service-sans"
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		svc := &corev1.Service{}
+		svc.Namespace = ns.Name
+		svc.Name = "webhook"
+		svc.Spec.Ports = []corev1.ServicePort{{Port: 443}}
+		Expect(k8sClient.Create(ctx, svc)).To(Succeed())
+
+		ips, err := ServiceIPAddresses(ctx, k8sClient, client.ObjectKeyFromObject(svc))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ips).To(ConsistOf(WithTransform(net.IP.String, Equal(svc.Spec.ClusterIP))))
+	})
+
+	It("should return SPIFFE ID", func() {
+		id, err := SPIFFEID("cluster.local", "foo", "webhook")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(id.String()).To(Equal("spiffe://cluster.local/ns/foo/sa/webhook"))
+
+		_, err = SPIFFEID("Cluster.Local", "foo", "webhook")
+		Expect(err).To(HaveOccurred())
+		_, err = SPIFFEID("cluster.local", "foo/bar", "webhook")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,172 @@
+package authority
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/healthz"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// Server is an HTTPS server using the serving certificate of the dynamic
+// authority, for plain HTTP APIs like conversion endpoints or extension API
+// servers. It implements manager.Runnable, and is run by all replicas
+// regardless of leader election.
+//
+// The server waits for the serving certificate to be issued before it starts
+// listening, and shuts down gracefully when the manager is stopped. It must be
+// created using ServingCertificateOperator.NewServer.
+type Server struct {
+	// The address to listen on, e.g. ":8443".
+	Addr string
+
+	// The handler serving requests.
+	Handler http.Handler
+
+	// Additional tls.Config options, applied after the defaults. E.g.
+	// ServingCertificateOperator.VerifyClientCertificate to require client
+	// certificates.
+	TLSOpts []func(*tls.Config)
+
+	// If set, HTTP/2 is enabled. It is disabled by default to avoid exposure
+	// to HTTP/2 vulnerabilities like CVE-2023-44487.
+	EnableHTTP2 bool
+
+	// The maximum amount of time to wait for in-flight requests to complete
+	// on shutdown. Defaults to 30 seconds.
+	ShutdownTimeout time.Duration
+
+	certificateHolder *CertificateHolder
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// NewServer returns a Server serving handler on addr, using the serving
+// certificate. It must be called before the operator is set up with the
+// manager. The server must be added to the manager using manager.Add.
+func (o *ServingCertificateOperator) NewServer(addr string, handler http.Handler) *Server {
+	servingCertificate := o.ServingCertificate()
+	return &Server{
+		Addr:              addr,
+		Handler:           handler,
+		TLSOpts:           []func(*tls.Config){servingCertificate},
+		certificateHolder: o.certificateHolder,
+	}
+}
+
+var _ manager.Runnable = &Server{}
+var _ manager.LeaderElectionRunnable = &Server{}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable; all replicas
+// serve requests.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start implements manager.Runnable.
+func (s *Server) Start(ctx context.Context) error {
+	if s.certificateHolder == nil {
+		return errors.New("server has no serving certificate, it must be created using ServingCertificateOperator.NewServer")
+	}
+	log := log.FromContext(ctx).WithName("https-server").WithValues("addr", s.Addr)
+
+	log.Info("Waiting for serving certificate")
+	if err := wait.PollUntilContextCancel(ctx, 100*time.Millisecond, true, func(context.Context) (bool, error) {
+		_, err := s.certificateHolder.GetCertificate(nil)
+		return err == nil, nil
+	}); err != nil {
+		// Stopped before the certificate was issued
+		return nil
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"http/1.1"},
+	}
+	if s.EnableHTTP2 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	}
+	for _, opt := range s.TLSOpts {
+		opt(config)
+	}
+
+	srv := &http.Server{
+		Handler:           s.Handler,
+		TLSConfig:         config,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       90 * time.Second,
+	}
+	if !s.EnableHTTP2 {
+		// A non-nil map prevents net/http from configuring HTTP/2
+		srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	shutdownTimeout := s.ShutdownTimeout
+	if shutdownTimeout == 0 {
+		shutdownTimeout = 30 * time.Second
+	}
+	idleConnsClosed := make(chan struct{})
+	go func() {
+		defer close(idleConnsClosed)
+		<-ctx.Done()
+		log.Info("Shutting down server", "timeout", shutdownTimeout)
+
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Error(err, "error shutting down the HTTPS server")
+		}
+	}()
+
+	log.Info("Serving HTTPS", "addr", listener.Addr().String())
+	if err := srv.ServeTLS(listener, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	<-idleConnsClosed
+	return nil
+}
+
+// StartedChecker returns a healthz.Checker that succeeds once the server is
+// serving, e.g. to be used as a readiness check of the manager.
+func (s *Server) StartedChecker() healthz.Checker {
+	config := &tls.Config{
+		InsecureSkipVerify: true, //nolint:gosec // config is used to connect to our own port.
+	}
+	return func(*http.Request) error {
+		s.mu.Lock()
+		listener := s.listener
+		s.mu.Unlock()
+
+		if listener == nil {
+			return errors.New("HTTPS server has not been started yet")
+		}
+
+		d := &net.Dialer{Timeout: 10 * time.Second}
+		conn, err := tls.DialWithDialer(d, "tcp", listener.Addr().String(), config)
+		if err != nil {
+			return fmt.Errorf("HTTPS server is not reachable: %w", err)
+		}
+		if err := conn.Close(); err != nil {
+			return fmt.Errorf("HTTPS server is not reachable: closing connection: %w", err)
+		}
+		return nil
+	}
+}
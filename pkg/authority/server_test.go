@@ -0,0 +1,80 @@
+package authority
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+var _ = Describe("Server", func() {
+	It("should serve HTTPS once the serving certificate is issued", func() {
+		operator := &ServingCertificateOperator{}
+		server := operator.NewServer("127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			_, _ = io.WriteString(w, req.Proto)
+		}))
+		started := server.StartedChecker()
+
+		serverCtx, cancel := context.WithCancel(ctx)
+		done := make(chan error)
+		go func() {
+			done <- server.Start(serverCtx)
+		}()
+
+		By("waiting for the serving certificate")
+		Consistently(started).WithArguments(&http.Request{}).Should(MatchError(ContainSubstring("not been started")))
+
+		opts := Options{CADuration: time.Hour, LeafDuration: time.Hour}
+		caCert, caPK, err := GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caPkBytes, err := pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+		r := reconciler{Opts: opts}
+		certData, pkData, err := r.issueLeaf(ctx, ServerProfile(), &x509.Certificate{DNSNames: []string{"localhost"}}, x509.ECDSA, caCertBytes, caPkBytes)
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := newTLSCertificate(certData, pkData)
+		Expect(err).ToNot(HaveOccurred())
+		operator.certificateHolder.SetCertificate(cert)
+
+		Eventually(started).WithArguments(&http.Request{}).Should(Succeed())
+
+		By("calling the server")
+		rootCAs := x509.NewCertPool()
+		rootCAs.AddCert(caCert)
+		client := &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: rootCAs, ServerName: "localhost"},
+			ForceAttemptHTTP2: true,
+		}}
+		resp, err := client.Get("https://" + server.listener.Addr().String())
+		Expect(err).ToNot(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.TLS.Version).To(BeNumerically(">=", tls.VersionTLS12))
+		Expect(io.ReadAll(resp.Body)).To(BeEquivalentTo("HTTP/1.1"))
+
+		By("shutting down")
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("should stop if not started before shutdown", func() {
+		server := (&ServingCertificateOperator{}).NewServer("127.0.0.1:0", http.NotFoundHandler())
+
+		serverCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect(server.Start(serverCtx)).To(Succeed())
+	})
+	It("should fail to start if not created by the operator", func() {
+		server := &Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+		Expect(server.Start(ctx)).To(MatchError(ContainSubstring("NewServer")))
+	})
+})
@@ -1,8 +1,6 @@
 package authority
 
 import (
-	"errors"
-	"fmt"
 	. "github.com/onsi/gomega"
 
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
@@ -11,7 +9,7 @@ import (
 	"k8s.io/utils/ptr"
 	"sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 
-	"github.com/erikgb/dynamic-authority/internal/pki"
+	"github.com/erikgb/dynamic-authority/internal/pki/pkitest"
 )
 
 func assertCASecret(secret *corev1.Secret) {
@@ -19,20 +17,11 @@ func assertCASecret(secret *corev1.Secret) {
 		HaveField("Labels", HaveKeyWithValue(DynamicAuthoritySecretLabel, "true")),
 		HaveField("Type", Equal(corev1.SecretTypeTLS)),
 		HaveField("Data", And(
-			HaveKeyWithValue(corev1.TLSCertKey, Not(BeEmpty())),
-			HaveKeyWithValue(corev1.TLSPrivateKeyKey, Not(BeEmpty())),
-			HaveKeyWithValue(TLSCABundleKey, Not(BeEmpty())),
+			pkitest.HaveKeyPair(corev1.TLSCertKey, corev1.TLSPrivateKeyKey),
+			pkitest.HaveCACertificate(corev1.TLSCertKey),
+			pkitest.HaveCertificateInBundle(corev1.TLSCertKey, TLSCABundleKey),
 		)),
 	))
-
-	cert, err := pki.DecodeX509CertificateBytes(secret.Data[corev1.TLSCertKey])
-	Expect(err).ToNot(HaveOccurred())
-	caBundle, err := pki.DecodeX509CertificateSetBytes(secret.Data[TLSCABundleKey])
-	Expect(err).ToNot(HaveOccurred())
-
-	Expect(secretPublicKeysDiffer(secret)).To(BeFalse())
-	Expect(cert.Subject).To(Equal(cert.Issuer))
-	Expect(caBundle).To(ContainElement(cert))
 }
 
 func NewValidatingWebhookConfigurationForTest(name string, caSecret types.NamespacedName) *admissionregistrationv1.ValidatingWebhookConfiguration {
@@ -59,24 +48,3 @@ func newValidatingWebhookForTest(name string) admissionregistrationv1.Validating
 		},
 	}
 }
-
-func secretPublicKeysDiffer(secret *corev1.Secret) (bool, error) {
-	pk, err := pki.DecodePrivateKeyBytes(secret.Data[corev1.TLSPrivateKeyKey])
-	if err != nil {
-		return true, fmt.Errorf("secret contains invalid private key data: %w", err)
-	}
-	x509Cert, err := pki.DecodeX509CertificateBytes(secret.Data[corev1.TLSCertKey])
-	if err != nil {
-		return true, fmt.Errorf("secret contains an invalid certificate: %w", err)
-	}
-
-	equal, err := pki.PublicKeysEqual(x509Cert.PublicKey, pk.Public())
-	if err != nil {
-		return true, fmt.Errorf("secret contains an invalid key-pair: %w", err)
-	}
-	if !equal {
-		return true, errors.New("secret contains a private key that does not match the certificate")
-	}
-
-	return false, nil
-}
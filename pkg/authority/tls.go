@@ -1,72 +1,216 @@
 package authority
 
 import (
+	"context"
 	"crypto"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"errors"
 	"fmt"
 	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"k8s.io/utils/clock"
+
 	"github.com/erikgb/dynamic-authority/internal/pki"
+	pkierrors "github.com/erikgb/dynamic-authority/internal/pki/errors"
 )
 
 // Sign will sign the given certificate template using the current version of
-// the managed CA.
+// the managed CA, with the usages of the template. It is signed with the
+// profile of the extended key usages of the template, e.g. ServerProfile
+// requiring a subject alternative name, or a custom profile otherwise. Use
+// SignWithProfile to sign with the usages of a CertificateProfile.
 // It will automatically set the NotBefore and NotAfter times appropriately.
 func Sign(opts Options, template *x509.Certificate, currentCertData []byte, currentPrivateKeyData []byte) (*x509.Certificate, error) {
-	// tls.X509KeyPair performs a number of verification checks against the
-	// keypair, so we run it to verify the certificate and private key are
-	// valid.
-	_, err := tls.X509KeyPair(currentCertData, currentPrivateKeyData)
+	return SignWithProfile(opts, templateProfile(template), template, currentCertData, currentPrivateKeyData)
+}
+
+// SignWithProfile will sign the given certificate template using the current
+// version of the managed CA, with the usages and duration of the profile.
+// It will automatically set the NotBefore and NotAfter times appropriately.
+func SignWithProfile(opts Options, profile CertificateProfile, template *x509.Certificate, currentCertData []byte, currentPrivateKeyData []byte) (*x509.Certificate, error) {
+	caCert, caPk, err := prepareSign(opts, profile.duration(opts), template, currentCertData, currentPrivateKeyData)
 	if err != nil {
-		return nil, fmt.Errorf("failed verifying CA keypair: %v", err)
+		return nil, err
+	}
+	if err := profile.apply(template); err != nil {
+		return nil, err
+	}
+
+	_, cert, err := pki.SignCertificate(template, caCert, template.PublicKey.(crypto.PublicKey), caPk)
+	if err != nil {
+		return nil, err
 	}
 
+	return cert, nil
+}
+
+// CSRPolicy restricts the certificates signed by SignCSR. Subjects, subject
+// alternative names and usages not explicitly allowed are refused.
+type CSRPolicy = pki.CSRPolicy
+
+// SignCSR will sign a certificate for the given PEM encoded PKCS#10
+// certificate signing request using the current version of the managed CA,
+// allowing components to request certificates without handing over their
+// private key. The certificate has the subject, subject alternative names and
+// usages requested, and the profile of the extended key usages requested, as
+// for Sign. It returns an error matching ErrPolicyViolation if the request is
+// not allowed by the policy or the profile.
+// It will automatically set the NotBefore and NotAfter times as Sign, with
+// the validity truncated to the maximum duration of the policy.
+func SignCSR(opts Options, policy CSRPolicy, csrData []byte, currentCertData []byte, currentPrivateKeyData []byte) (*x509.Certificate, error) {
+	csr, err := pki.DecodeX509CertificateRequestBytes(csrData)
+	if err != nil {
+		return nil, fmt.Errorf("failed decoding certificate request: %w", err)
+	}
+
+	template := &x509.Certificate{}
+	caCert, caPk, err := prepareSign(opts, opts.LeafDuration, template, currentCertData, currentPrivateKeyData)
+	if err != nil {
+		return nil, err
+	}
+
+	applyProfile := func(cert *x509.Certificate) error {
+		if err := templateProfile(cert).apply(cert); err != nil {
+			return fmt.Errorf("%w: %v", ErrPolicyViolation, err)
+		}
+		return nil
+	}
+	_, cert, err := pki.SignCSR(csr, template, policy, applyProfile, caCert, caPk)
+	if err != nil {
+		return nil, err
+	}
+
+	return cert, nil
+}
+
+// prepareSign decodes and verifies the current version of the managed CA,
+// and sets the serial number and validity of the template.
+func prepareSign(opts Options, duration time.Duration, template *x509.Certificate, currentCertData []byte, currentPrivateKeyData []byte) (*x509.Certificate, crypto.Signer, error) {
 	caCert, err := pki.DecodeX509CertificateBytes(currentCertData)
 	if err != nil {
-		return nil, fmt.Errorf("failed decoding CA certificate: %v", err)
+		return nil, nil, fmt.Errorf("failed decoding CA certificate: %w", err)
 	}
 
 	caPk, err := pki.DecodePrivateKeyBytes(currentPrivateKeyData)
 	if err != nil {
-		return nil, fmt.Errorf("failed decoding CA private key: %v", err)
+		return nil, nil, fmt.Errorf("failed decoding CA private key: %w", err)
 	}
 
-	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	equal, err := pki.PublicKeysEqual(caCert.PublicKey, caPk.Public())
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("failed verifying CA keypair: %w", err)
+	}
+	if !equal {
+		return nil, nil, fmt.Errorf("failed verifying CA keypair: %w", ErrKeyMismatch)
+	}
+
+	// tls.X509KeyPair performs a number of verification checks against the
+	// keypair, so we run it to verify the certificate and private key are
+	// valid.
+	if _, err := tls.X509KeyPair(currentCertData, currentPrivateKeyData); err != nil {
+		return nil, nil, pkierrors.NewInvalidData("failed verifying CA keypair: %v", err)
+	}
+
+	serialNumber, err := newSerialNumber(caPk)
+	if err != nil {
+		return nil, nil, err
 	}
 	template.Version = 3
 	template.SerialNumber = serialNumber
 	template.BasicConstraintsValid = true
-	template.NotBefore = time.Now()
-	template.NotAfter = template.NotBefore.Add(opts.LeafDuration)
+	now := opts.clock().Now()
+	template.NotBefore = now.Add(-opts.NotBeforeBackdate)
+	template.NotAfter = now.Add(duration)
 	// explicitly handle the case of the root CA certificate being expired
-	if caCert.NotAfter.Before(template.NotBefore) {
-		return nil, fmt.Errorf("internal error: CA certificate has expired, try again later")
+	if caCert.NotAfter.Before(now) {
+		return nil, nil, fmt.Errorf("%w, try again later", ErrCAExpired)
 	}
 	// don't allow leaf certificates to be valid longer than their parents
 	if caCert.NotAfter.Before(template.NotAfter) {
 		template.NotAfter = caCert.NotAfter
 	}
 
-	_, cert, err := pki.SignCertificate(template, caCert, template.PublicKey.(crypto.PublicKey), caPk)
+	return caCert, caPk, nil
+}
+
+// renewAfter returns the duration until the given certificate should be
+// renewed, which is after 2/3 of its lifetime.
+func renewAfter(clock clock.PassiveClock, cert *x509.Certificate) time.Duration {
+	lifetime := cert.NotAfter.Sub(cert.NotBefore)
+	return cert.NotBefore.Add(lifetime * 2 / 3).Sub(clock.Now())
+}
+
+var serialNumberLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+
+const (
+	// serialNumberRandomLen is the number of random bytes of a serial number
+	// issued by the CA, followed by serialNumberTagLen bytes of its tag.
+	serialNumberRandomLen = 16
+	serialNumberTagLen    = 4
+)
+
+// newSerialNumber returns a random serial number, tagged with a MAC keyed by
+// the private key of the issuing CA. This allows the OCSP responder to tell
+// the serial numbers issued by the CA without keeping track of them.
+func newSerialNumber(caPk crypto.Signer) (*big.Int, error) {
+	key, err := serialNumberKey(caPk)
 	if err != nil {
 		return nil, err
 	}
+	b := make([]byte, serialNumberRandomLen, serialNumberRandomLen+serialNumberTagLen)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	// Keep the serial number positive, and within the 20 octets allowed by
+	// RFC 5280 when DER encoded
+	b[0] &= 0x7f
+	return new(big.Int).SetBytes(append(b, serialNumberTag(key, b)...)), nil
+}
 
-	return cert, nil
+// issuedSerialNumber returns true if the serial number is tagged with the
+// given key, see newSerialNumber.
+func issuedSerialNumber(key []byte, serialNumber *big.Int) bool {
+	if serialNumber.Sign() <= 0 || serialNumber.BitLen() > 8*(serialNumberRandomLen+serialNumberTagLen) {
+		return false
+	}
+	b := serialNumber.FillBytes(make([]byte, serialNumberRandomLen+serialNumberTagLen))
+	return hmac.Equal(b[serialNumberRandomLen:], serialNumberTag(key, b[:serialNumberRandomLen]))
 }
 
-var serialNumberLimit = new(big.Int).Lsh(big.NewInt(1), 128)
+// serialNumberKey derives the key tagging the serial numbers issued by the
+// CA from its private key.
+func serialNumberKey(caPk crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(caPk)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte("dynamic-authority serial number"))
+	mac.Write(der)
+	return mac.Sum(nil), nil
+}
 
-// generateCA will regenerate a new CA.
-func generateCA(opts Options) (*x509.Certificate, crypto.Signer, error) {
+func serialNumberTag(key, random []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(random)
+	return mac.Sum(nil)[:serialNumberTagLen]
+}
+
+// GenerateCA generates a new self-signed CA certificate and private key, as
+// the dynamic authority does when it creates or rotates the CA. Its validity
+// starts at the current time of the clock of opts, backdated by
+// NotBeforeBackdate, and lasts CADuration.
+func GenerateCA(opts Options) (*x509.Certificate, crypto.Signer, error) {
 	pk, err := pki.GenerateECPrivateKey(384)
 	if err != nil {
 		return nil, nil, err
@@ -76,18 +220,19 @@ func generateCA(opts Options) (*x509.Certificate, crypto.Signer, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+	now := opts.clock().Now()
 	cert := &x509.Certificate{
-		Version:               3,
-		BasicConstraintsValid: true,
-		SerialNumber:          serialNumber,
-		PublicKeyAlgorithm:    x509.ECDSA,
+		SerialNumber:       serialNumber,
+		PublicKeyAlgorithm: x509.ECDSA,
+		PublicKey:          pk.Public(),
 		Subject: pkix.Name{
 			CommonName: "cert-manager-dynamic-ca",
 		},
-		IsCA:      true,
-		NotBefore: time.Now(),
-		NotAfter:  time.Now().Add(opts.CADuration),
-		KeyUsage:  x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment | x509.KeyUsageCertSign,
+		NotBefore: now.Add(-opts.NotBeforeBackdate),
+		NotAfter:  now.Add(CAProfile().duration(opts)),
+	}
+	if err := CAProfile().apply(cert); err != nil {
+		return nil, nil, err
 	}
 	// self sign the root CA
 	_, cert, err = pki.SignCertificate(cert, cert, pk.Public(), pk)
@@ -96,14 +241,37 @@ func generateCA(opts Options) (*x509.Certificate, crypto.Signer, error) {
 }
 
 var (
-	ErrCertNotAvailable = errors.New("no tls.Certificate available")
+	ErrCertNotAvailable     = errors.New("no tls.Certificate available")
+	ErrCABundleNotAvailable = errors.New("no CA bundle available")
 )
 
 type CertificateHolder struct {
 	certP atomic.Pointer[tls.Certificate]
+	sniP  atomic.Pointer[sniCertificates]
 }
 
-func (h *CertificateHolder) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+// GetCertificate returns the certificate to serve for a TLS handshake.
+// A certificate set by SetSNICertificates matching the requested server name
+// is preferred, falling back to the default certificate set by
+// SetCertificate. If several certificates match, the first one supported by
+// the client, e.g. by signature schemes, is returned.
+func (h *CertificateHolder) GetCertificate(info *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if info != nil && info.ServerName != "" {
+		if certs := h.sniP.Load().match(info.ServerName); len(certs) > 0 {
+			return selectCertificate(info, certs), nil
+		}
+	}
+
+	cert := h.certP.Load()
+	if cert == nil {
+		return nil, ErrCertNotAvailable
+	}
+	return cert, nil
+}
+
+// GetClientCertificate returns the certificate set by SetCertificate, to be
+// presented to servers requesting a client certificate.
+func (h *CertificateHolder) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
 	cert := h.certP.Load()
 	if cert == nil {
 		return nil, ErrCertNotAvailable
@@ -114,3 +282,213 @@ func (h *CertificateHolder) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certifi
 func (h *CertificateHolder) SetCertificate(cert *tls.Certificate) {
 	h.certP.Store(cert)
 }
+
+// SetSNICertificates replaces the certificates selected by SNI server name.
+// The DNS names of each certificate are used as the patterns matched against
+// the server name, and may contain a wildcard as the left-most label.
+func (h *CertificateHolder) SetSNICertificates(certs []*tls.Certificate) error {
+	sni := &sniCertificates{byName: map[string][]*tls.Certificate{}}
+	for _, cert := range certs {
+		leaf, err := parseLeaf(cert)
+		if err != nil {
+			return err
+		}
+		for _, dnsName := range leaf.DNSNames {
+			name := normalizeServerName(dnsName)
+			sni.byName[name] = append(sni.byName[name], cert)
+		}
+	}
+	h.sniP.Store(sni)
+	return nil
+}
+
+// sniCertificates indexes certificates by the DNS names they are valid for.
+// Wildcard names are indexed with their "*." prefix.
+type sniCertificates struct {
+	byName map[string][]*tls.Certificate
+}
+
+func (s *sniCertificates) match(serverName string) []*tls.Certificate {
+	if s == nil {
+		return nil
+	}
+
+	serverName = normalizeServerName(serverName)
+	if certs, ok := s.byName[serverName]; ok {
+		return certs
+	}
+	if _, parent, ok := strings.Cut(serverName, "."); ok {
+		return s.byName["*."+parent]
+	}
+	return nil
+}
+
+func normalizeServerName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+// selectCertificate returns the first certificate supported by the client,
+// or the first certificate if none of them are.
+func selectCertificate(info *tls.ClientHelloInfo, certs []*tls.Certificate) *tls.Certificate {
+	for _, cert := range certs {
+		if info.SupportsCertificate(cert) == nil {
+			return cert
+		}
+	}
+	return certs[0]
+}
+
+// newTLSCertificate parses a PEM encoded certificate chain and private key
+// into a tls.Certificate, with the Leaf field populated.
+func newTLSCertificate(certData, pkData []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certData, pkData)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Leaf, err = parseLeaf(&cert); err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+func parseLeaf(cert *tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("tls.Certificate contains no certificates")
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+// CABundleHolder holds a pool of trusted CA certificates that can be replaced
+// at runtime, e.g. when the CA is rotated.
+type CABundleHolder struct {
+	poolP atomic.Pointer[x509.CertPool]
+}
+
+func (h *CABundleHolder) GetCertPool() (*x509.CertPool, error) {
+	pool := h.poolP.Load()
+	if pool == nil {
+		return nil, ErrCABundleNotAvailable
+	}
+	return pool, nil
+}
+
+// verifyConnection returns a tls.Config.VerifyConnection function verifying
+// the peer certificate chain of a TLS connection against the current CA
+// bundle, and the server certificate against serverName, or the server name
+// of the connection if empty. Connections without a server name, e.g. to an
+// IP address, are refused, as the server certificate would be trusted for any
+// name. If next is set, it is called after successful verification.
+func (h *CABundleHolder) verifyConnection(serverName string, next func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	return func(cs tls.ConnectionState) error {
+		roots, err := h.GetCertPool()
+		if err != nil {
+			return err
+		}
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no peer certificate presented")
+		}
+		name := serverName
+		if name == "" {
+			name = cs.ServerName
+		}
+		if name == "" {
+			return errors.New("no server name to verify the server certificate against, set tls.Config.ServerName")
+		}
+
+		intermediates := x509.NewCertPool()
+		for _, cert := range cs.PeerCertificates[1:] {
+			intermediates.AddCert(cert)
+		}
+		// DNSName may also be an IP address, matched against IP SANs
+		if _, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+			DNSName:       name,
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}); err != nil {
+			return err
+		}
+
+		if next != nil {
+			return next(cs)
+		}
+		return nil
+	}
+}
+
+// SetCertificates replaces the trusted CA certificates. The pool is kept if
+// the certificates are unchanged, so clients don't drop their connections.
+func (h *CABundleHolder) SetCertificates(certs []*x509.Certificate) {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+	if current := h.poolP.Load(); current != nil && current.Equal(pool) {
+		return
+	}
+	h.poolP.Store(pool)
+}
+
+// caBundleRoundTripper closes idle connections whenever the CA bundle changes,
+// so that new connections are verified against the current CA bundle.
+type caBundleRoundTripper struct {
+	transport *http.Transport
+	rootCAs   *CABundleHolder
+
+	mu       sync.Mutex
+	lastPool *x509.CertPool
+}
+
+func (rt *caBundleRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if pool, err := rt.rootCAs.GetCertPool(); err == nil {
+		rt.mu.Lock()
+		if rt.lastPool != pool {
+			rt.transport.CloseIdleConnections()
+			rt.lastPool = pool
+		}
+		rt.mu.Unlock()
+	}
+	return rt.transport.RoundTrip(req)
+}
+
+// dialTLSContext returns a http.Transport.DialTLSContext function that
+// verifies servers against the current CA bundle and the host dialled, unless
+// the ServerName of the TLSClientConfig of the transport is set. As opposed to
+// the server name of the connection, the host may be an IP address. If next
+// is set, it is called after successful verification.
+func (h *CABundleHolder) dialTLSContext(transport *http.Transport, next func(tls.ConnectionState) error) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dial := transport.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		config := transport.TLSClientConfig.Clone()
+		if config.ServerName == "" {
+			config.ServerName = host
+		}
+		config.VerifyConnection = h.verifyConnection(config.ServerName, next)
+
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		if transport.TLSHandshakeTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, transport.TLSHandshakeTimeout)
+			defer cancel()
+		}
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
@@ -0,0 +1,367 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	clocktesting "k8s.io/utils/clock/testing"
+
+	"github.com/erikgb/dynamic-authority/internal/pki"
+)
+
+var _ = Describe("Certificate Holder", func() {
+	var (
+		holder *CertificateHolder
+		issue  func(keyAlgorithm x509.PublicKeyAlgorithm, dnsNames ...string) *tls.Certificate
+	)
+
+	BeforeEach(func() {
+		opts := Options{CADuration: time.Hour, LeafDuration: time.Hour}
+		caCert, caPK, err := GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caPkBytes, err := pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		r := &LeafCertReconciler{reconciler: reconciler{Opts: opts}}
+		issue = func(keyAlgorithm x509.PublicKeyAlgorithm, dnsNames ...string) *tls.Certificate {
+			certData, pkData, err := r.issueLeaf(ctx, ServerProfile(), &x509.Certificate{DNSNames: dnsNames}, keyAlgorithm, caCertBytes, caPkBytes)
+			Expect(err).ToNot(HaveOccurred())
+			cert, err := newTLSCertificate(certData, pkData)
+			Expect(err).ToNot(HaveOccurred())
+			return cert
+		}
+
+		holder = &CertificateHolder{}
+	})
+
+	It("should return error if no certificate is available", func() {
+		_, err := holder.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.example.com"})
+		Expect(err).To(MatchError(ErrCertNotAvailable))
+	})
+
+	It("should return client certificate", func() {
+		_, err := holder.GetClientCertificate(&tls.CertificateRequestInfo{})
+		Expect(err).To(MatchError(ErrCertNotAvailable))
+
+		cert := issue(x509.ECDSA, "client.example.com")
+		holder.SetCertificate(cert)
+		Expect(holder.GetClientCertificate(&tls.CertificateRequestInfo{})).To(BeIdenticalTo(cert))
+	})
+
+	It("should select certificate by SNI server name", func() {
+		defaultCert := issue(x509.ECDSA, "default.example.com")
+		exactCert := issue(x509.ECDSA, "foo.example.com")
+		wildcardCert := issue(x509.ECDSA, "*.example.com")
+		holder.SetCertificate(defaultCert)
+		Expect(holder.SetSNICertificates([]*tls.Certificate{exactCert, wildcardCert})).To(Succeed())
+
+		Expect(holder.GetCertificate(nil)).To(BeIdenticalTo(defaultCert))
+		Expect(holder.GetCertificate(&tls.ClientHelloInfo{})).To(BeIdenticalTo(defaultCert))
+		Expect(holder.GetCertificate(&tls.ClientHelloInfo{ServerName: "FOO.example.com."})).To(BeIdenticalTo(exactCert))
+		Expect(holder.GetCertificate(&tls.ClientHelloInfo{ServerName: "bar.example.com"})).To(BeIdenticalTo(wildcardCert))
+		Expect(holder.GetCertificate(&tls.ClientHelloInfo{ServerName: "foo.bar.example.com"})).To(BeIdenticalTo(defaultCert))
+		Expect(holder.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})).To(BeIdenticalTo(defaultCert))
+	})
+
+	It("should select certificate by supported signature schemes", func() {
+		ecdsaCert := issue(x509.ECDSA, "foo.example.com")
+		rsaCert := issue(x509.RSA, "foo.example.com")
+		Expect(holder.SetSNICertificates([]*tls.Certificate{ecdsaCert, rsaCert})).To(Succeed())
+
+		hello := func(signatureSchemes ...tls.SignatureScheme) *tls.ClientHelloInfo {
+			return &tls.ClientHelloInfo{
+				ServerName:        "foo.example.com",
+				SignatureSchemes:  signatureSchemes,
+				SupportedVersions: []uint16{tls.VersionTLS13},
+			}
+		}
+		Expect(holder.GetCertificate(hello(tls.ECDSAWithP384AndSHA384, tls.PSSWithSHA256))).To(BeIdenticalTo(ecdsaCert))
+		Expect(holder.GetCertificate(hello(tls.PSSWithSHA256))).To(BeIdenticalTo(rsaCert))
+		Expect(holder.GetCertificate(hello(tls.Ed25519))).To(BeIdenticalTo(ecdsaCert))
+	})
+})
+
+var _ = Describe("Sign", func() {
+	It("should backdate leaf certificates and clamp them to the CA expiry", func() {
+		fakeClock := clocktesting.NewFakePassiveClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		opts := Options{
+			CADuration:        7 * 24 * time.Hour,
+			LeafDuration:      24 * time.Hour,
+			NotBeforeBackdate: 5 * time.Minute,
+			Clock:             fakeClock,
+		}
+		caCert, caPK, err := GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(caCert.NotBefore).To(BeTemporally("==", fakeClock.Now().Add(-5*time.Minute)))
+		Expect(caCert.NotAfter).To(BeTemporally("==", fakeClock.Now().Add(7*24*time.Hour)))
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caPkBytes, err := pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		r := reconciler{Opts: opts}
+		issue := func() (*x509.Certificate, error) {
+			certData, _, err := r.issueLeaf(ctx, ServerProfile(), &x509.Certificate{DNSNames: []string{"example.com"}}, x509.ECDSA, caCertBytes, caPkBytes)
+			if err != nil {
+				return nil, err
+			}
+			return pki.DecodeX509CertificateBytes(certData)
+		}
+
+		By("backdating")
+		leaf, err := issue()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(leaf.NotBefore).To(BeTemporally("==", fakeClock.Now().Add(-5*time.Minute)))
+		Expect(leaf.NotAfter).To(BeTemporally("==", fakeClock.Now().Add(24*time.Hour)))
+		Expect(renewAfter(fakeClock, leaf)).To(Equal(16*time.Hour + 5*time.Minute*2/3 - 5*time.Minute))
+
+		By("clamping to the CA expiry")
+		fakeClock.SetTime(caCert.NotAfter.Add(-time.Hour))
+		leaf, err = issue()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(leaf.NotAfter).To(BeTemporally("==", caCert.NotAfter))
+
+		By("refusing to sign with an expired CA")
+		fakeClock.SetTime(caCert.NotAfter.Add(time.Second))
+		_, err = issue()
+		Expect(err).To(MatchError(ContainSubstring("CA certificate has expired")))
+	})
+
+	It("should tag serial numbers with the key of the CA", func() {
+		_, caPK, err := GenerateCA(Options{CADuration: time.Hour})
+		Expect(err).ToNot(HaveOccurred())
+		_, otherCAPK, err := GenerateCA(Options{CADuration: time.Hour})
+		Expect(err).ToNot(HaveOccurred())
+		key, err := serialNumberKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+		otherKey, err := serialNumberKey(otherCAPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		serialNumber, err := newSerialNumber(caPK)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serialNumber.Sign()).To(Equal(1))
+		Expect(serialNumber.BitLen()).To(BeNumerically("<=", 159))
+		Expect(issuedSerialNumber(key, serialNumber)).To(BeTrue())
+		Expect(issuedSerialNumber(otherKey, serialNumber)).To(BeFalse())
+		Expect(issuedSerialNumber(key, new(big.Int).Add(serialNumber, big.NewInt(1)))).To(BeFalse())
+	})
+})
+
+var _ = Describe("SignCSR", func() {
+	var (
+		opts                   Options
+		caCert                 *x509.Certificate
+		caCertBytes, caPkBytes []byte
+		policy                 CSRPolicy
+		requestCSR             func(template *x509.CertificateRequest) []byte
+	)
+
+	BeforeEach(func() {
+		opts = Options{CADuration: 7 * 24 * time.Hour, LeafDuration: 24 * time.Hour}
+		var caPK crypto.Signer
+		var err error
+		caCert, caPK, err = GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err = pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caPkBytes, err = pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		_, ipNet, err := net.ParseCIDR("10.0.0.0/8")
+		Expect(err).ToNot(HaveOccurred())
+		policy = CSRPolicy{
+			AllowedCommonNames:   []string{"foo"},
+			AllowedOrganizations: []string{"example"},
+			AllowedDNSNames:      []string{"*.example.com"},
+			AllowedIPNets:        []*net.IPNet{ipNet},
+			AllowedKeyUsages:     x509.KeyUsageDigitalSignature,
+			AllowedExtKeyUsages:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			MaxDuration:          time.Hour,
+		}
+
+		requestCSR = func(template *x509.CertificateRequest) []byte {
+			GinkgoHelper()
+			pk, err := pki.GenerateECPrivateKey(pki.ECCurve256)
+			Expect(err).ToNot(HaveOccurred())
+			template.ExtraExtensions, err = pki.UsageExtensions(x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth})
+			Expect(err).ToNot(HaveOccurred())
+			csrData, err := pki.GenerateCSR(template, pk)
+			Expect(err).ToNot(HaveOccurred())
+			return csrData
+		}
+	})
+
+	It("should sign an allowed request with the requested usages", func() {
+		csrData := requestCSR(&x509.CertificateRequest{
+			Subject:     pkix.Name{CommonName: "foo", Organization: []string{"example"}},
+			DNSNames:    []string{"foo.example.com"},
+			IPAddresses: []net.IP{net.ParseIP("10.0.0.1")},
+		})
+
+		cert, err := SignCSR(opts, policy, csrData, caCertBytes, caPkBytes)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cert.CheckSignatureFrom(caCert)).To(Succeed())
+		Expect(cert.Subject.CommonName).To(Equal("foo"))
+		Expect(cert.Subject.Organization).To(Equal([]string{"example"}))
+		Expect(cert.DNSNames).To(Equal([]string{"foo.example.com"}))
+		Expect(cert.KeyUsage).To(Equal(x509.KeyUsageDigitalSignature))
+		Expect(cert.ExtKeyUsage).To(Equal([]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}))
+		Expect(cert.IsCA).To(BeFalse())
+		Expect(cert.NotAfter.Sub(cert.NotBefore)).To(Equal(time.Hour), "truncated to the maximum duration")
+	})
+
+	DescribeTable("should refuse a request violating the policy",
+		func(template *x509.CertificateRequest, mutate func(*CSRPolicy), violation string) {
+			mutate(&policy)
+			_, err := SignCSR(opts, policy, requestCSR(template), caCertBytes, caPkBytes)
+			Expect(err).To(MatchError(ErrPolicyViolation))
+			Expect(err).To(MatchError(ContainSubstring(violation)))
+		},
+		Entry("common name", &x509.CertificateRequest{Subject: pkix.Name{CommonName: "bar"}, DNSNames: []string{"foo.example.com"}}, func(*CSRPolicy) {}, `common name "bar" is not allowed`),
+		Entry("organization", &x509.CertificateRequest{Subject: pkix.Name{Organization: []string{"system:masters"}}, DNSNames: []string{"foo.example.com"}}, func(*CSRPolicy) {}, `organization "system:masters" is not allowed`),
+		Entry("other subject attributes", &x509.CertificateRequest{Subject: pkix.Name{OrganizationalUnit: []string{"admins"}}, DNSNames: []string{"foo.example.com"}}, func(*CSRPolicy) {}, "subject attributes other than the common name and organization are not allowed"),
+		Entry("DNS name", &x509.CertificateRequest{DNSNames: []string{"foo.bar.example.com"}}, func(*CSRPolicy) {}, `DNS name "foo.bar.example.com" is not allowed`),
+		Entry("IP address", &x509.CertificateRequest{IPAddresses: []net.IP{net.ParseIP("192.168.0.1")}}, func(*CSRPolicy) {}, "IP address 192.168.0.1 is not allowed"),
+		Entry("no subject alternative names", &x509.CertificateRequest{EmailAddresses: []string{"foo@example.com"}}, func(p *CSRPolicy) {
+			p.AllowedEmailAddresses = []string{"foo@example.com"}
+		}, "server certificate requires a subject alternative name of type [DNS IP URI]"),
+		Entry("key usage", &x509.CertificateRequest{DNSNames: []string{"foo.example.com"}}, func(p *CSRPolicy) {
+			p.AllowedKeyUsages = 0
+		}, "key usages 0x1 are not allowed"),
+		Entry("extended key usage", &x509.CertificateRequest{DNSNames: []string{"foo.example.com"}}, func(p *CSRPolicy) {
+			p.AllowedExtKeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		}, "extended key usage 1 is not allowed"),
+	)
+
+	It("should request key usages in minimal DER", func() {
+		csrData := requestCSR(&x509.CertificateRequest{DNSNames: []string{"foo.example.com"}})
+		csr, err := pki.DecodeX509CertificateRequestBytes(csrData)
+		Expect(err).ToNot(HaveOccurred())
+		cert, err := SignCSR(opts, policy, csrData, caCertBytes, caPkBytes)
+		Expect(err).ToNot(HaveOccurred())
+
+		keyUsage := pkix.Extension{Id: asn1.ObjectIdentifier{2, 5, 29, 15}, Critical: true}
+		for _, ext := range cert.Extensions {
+			if ext.Id.Equal(keyUsage.Id) {
+				keyUsage.Value = ext.Value
+			}
+		}
+		Expect(csr.Extensions).To(ContainElement(keyUsage), "as encoded by crypto/x509")
+	})
+
+	It("should refuse a request with an invalid signature", func() {
+		csrData := requestCSR(&x509.CertificateRequest{DNSNames: []string{"foo.example.com"}})
+		block, _ := pem.Decode(csrData)
+		block.Bytes[len(block.Bytes)-1] ^= 0xff
+
+		_, err := SignCSR(opts, policy, pem.EncodeToMemory(block), caCertBytes, caPkBytes)
+		Expect(err).To(MatchError(ErrInvalidData))
+	})
+})
+
+var _ = Describe("CA Bundle Holder", func() {
+	var (
+		holder   *CABundleHolder
+		operator *ServingCertificateOperator
+		caCert   *x509.Certificate
+		address  string
+	)
+
+	BeforeEach(func() {
+		opts := Options{CADuration: time.Hour, LeafDuration: time.Hour}
+		var caPK crypto.Signer
+		var err error
+		caCert, caPK, err = GenerateCA(opts)
+		Expect(err).ToNot(HaveOccurred())
+		caCertBytes, err := pki.EncodeX509(caCert)
+		Expect(err).ToNot(HaveOccurred())
+		caPkBytes, err := pki.EncodePrivateKey(caPK)
+		Expect(err).ToNot(HaveOccurred())
+
+		pk, err := pki.GenerateECPrivateKey(pki.ECCurve256)
+		Expect(err).ToNot(HaveOccurred())
+		leaf, err := Sign(opts, &x509.Certificate{
+			PublicKey:   pk.Public(),
+			DNSNames:    []string{"foo.example.com"},
+			IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+		}, caCertBytes, caPkBytes)
+		Expect(err).ToNot(HaveOccurred())
+
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, PrivateKey: pk}}}
+		server.StartTLS()
+		DeferCleanup(server.Close)
+		address = server.Listener.Addr().String()
+
+		holder = &CABundleHolder{}
+		holder.SetCertificates([]*x509.Certificate{caCert})
+		operator = &ServingCertificateOperator{rootCAHolder: holder}
+	})
+
+	handshake := func(config *tls.Config) error {
+		conn, err := tls.Dial("tcp", address, config)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	It("should verify the server certificate against the server name", func() {
+		for serverName, matcher := range map[string]OmegaMatcher{
+			"foo.example.com": Succeed(),
+			"127.0.0.1":       Succeed(),
+			"bar.example.com": MatchError(ContainSubstring("not bar.example.com")),
+			"":                MatchError(ContainSubstring("no server name")),
+		} {
+			config := &tls.Config{ServerName: serverName}
+			operator.VerifyServerCertificate()(config)
+			Expect(handshake(config)).To(matcher, "server name %q", serverName)
+		}
+	})
+
+	It("should call the existing VerifyConnection after verification", func() {
+		errVerify := errors.New("refused by existing VerifyConnection")
+		config := &tls.Config{
+			ServerName:       "foo.example.com",
+			VerifyConnection: func(tls.ConnectionState) error { return errVerify },
+		}
+		operator.VerifyServerCertificate()(config)
+		Expect(handshake(config)).To(MatchError(ContainSubstring(errVerify.Error())))
+	})
+
+	It("should verify servers dialled by IP address using the round tripper", func() {
+		httpClient := &http.Client{Transport: operator.RoundTripper(nil)}
+		resp, err := httpClient.Get("https://" + address)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.Body.Close()).To(Succeed())
+		Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+	})
+
+	It("should keep the pool while the certificates are unchanged", func() {
+		pool, err := holder.GetCertPool()
+		Expect(err).ToNot(HaveOccurred())
+		holder.SetCertificates([]*x509.Certificate{caCert})
+		Expect(holder.GetCertPool()).To(BeIdenticalTo(pool))
+
+		otherCA, _, err := GenerateCA(Options{CADuration: time.Hour})
+		Expect(err).ToNot(HaveOccurred())
+		holder.SetCertificates([]*x509.Certificate{caCert, otherCA})
+		Expect(holder.GetCertPool()).ToNot(BeIdenticalTo(pool))
+	})
+})
@@ -2,13 +2,21 @@ package controller
 
 import (
 	"crypto/tls"
+	"net"
+	"strconv"
+	"time"
+
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/envtest/komega"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
@@ -18,8 +26,11 @@ import (
 
 var _ = Describe("Controller Integration Test", Ordered, func() {
 	var (
-		caSecretRef types.NamespacedName
-		tlsConfig   *tls.Config
+		caSecretRef     types.NamespacedName
+		tlsConfig       *tls.Config
+		clientTLSConfig *tls.Config
+		webhookAddr     string
+		operator        *authority.ServingCertificateOperator
 	)
 
 	BeforeAll(func() {
@@ -32,20 +43,39 @@ var _ = Describe("Controller Integration Test", Ordered, func() {
 			Name:      "ca-cert",
 		}
 
-		operator := &authority.ServingCertificateOperator{
+		operator = &authority.ServingCertificateOperator{
 			Options: authority.Options{
 				Namespace: caSecretRef.Namespace,
 				CASecret:  caSecretRef.Name,
+				DNSNames:  []string{"webhook.dynamic-authority.svc"},
+				Injectables: []authority.Injectable{
+					&authority.ValidatingWebhookCaBundleInject{},
+					&widgetInject{},
+					&authority.ConfigMapCaBundleInject{},
+				},
+				InjectableNamespaceSelector: labels.SelectorFromSet(labels.Set{injectLabel: "true"}),
+				InjectableDiscoveryInterval: time.Second,
 			},
 		}
 
 		servingCertificate := operator.ServingCertificate()
+		verifyClientCertificate := operator.VerifyClientCertificate()
 
 		tlsConfig = &tls.Config{}
 		servingCertificate(tlsConfig)
+		verifyClientCertificate(tlsConfig)
 		Expect(tlsConfig.GetCertificate).ToNot(BeNil())
+		Expect(tlsConfig.GetConfigForClient).ToNot(BeNil())
+
+		// The webhook server is dialled by IP address, so the server name
+		// to verify its certificate against must be set
+		clientTLSConfig = &tls.Config{ServerName: "webhook.dynamic-authority.svc"}
+		operator.ClientCertificate()(clientTLSConfig)
+		operator.VerifyServerCertificate()(clientTLSConfig)
+		Expect(clientTLSConfig.GetClientCertificate).ToNot(BeNil())
 
 		webhookInstallOptions := &testEnv.WebhookInstallOptions
+		webhookAddr = net.JoinHostPort(webhookInstallOptions.LocalServingHost, strconv.Itoa(webhookInstallOptions.LocalServingPort))
 		k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
 			Scheme: scheme.Scheme,
 			Metrics: metricsserver.Options{
@@ -54,12 +84,14 @@ var _ = Describe("Controller Integration Test", Ordered, func() {
 			WebhookServer: webhook.NewServer(webhook.Options{
 				Host:    webhookInstallOptions.LocalServingHost,
 				Port:    webhookInstallOptions.LocalServingPort,
-				TLSOpts: []func(*tls.Config){servingCertificate},
+				TLSOpts: []func(*tls.Config){servingCertificate, verifyClientCertificate},
 			}),
 		})
 		Expect(err).ToNot(HaveOccurred())
 
 		Expect(operator.SetupWithManager(k8sManager)).To(Succeed())
+		// Start the webhook server, which serves no webhooks
+		_ = k8sManager.GetWebhookServer()
 
 		go func() {
 			defer GinkgoRecover()
@@ -79,9 +111,165 @@ var _ = Describe("Controller Integration Test", Ordered, func() {
 		)
 	})
 
+	It("should report injectables of kinds not served as inactive", func() {
+		Expect(operator.InactiveInjectables()).To(ConsistOf((&widgetInject{}).GroupVersionKind()))
+	})
+
+	It("should inject CA bundle into custom resources once their kind is served", func() {
+		Expect(k8sClient.Create(ctx, newWidgetCRD())).To(Succeed())
+		Eventually(operator.InactiveInjectables).WithTimeout(30 * time.Second).Should(BeEmpty())
+
+		widget := &unstructured.Unstructured{}
+		widget.SetGroupVersionKind((&widgetInject{}).GroupVersionKind())
+		widget.SetName("test-widget")
+		widget.SetLabels(map[string]string{
+			authority.WantInjectFromSecretNamespaceLabel: caSecretRef.Namespace,
+			authority.WantInjectFromSecretNameLabel:      caSecretRef.Name,
+		})
+		// The client discovers the kind once the CRD is established
+		Eventually(func() error {
+			return k8sClient.Create(ctx, widget)
+		}).Should(Succeed())
+
+		Eventually(komega.Object(widget)).Should(
+			HaveField("Object", HaveKeyWithValue("spec", HaveKeyWithValue("caBundle", Not(BeEmpty())))),
+		)
+	})
+
+	It("should inject CA bundle into ConfigMaps in namespaces once they are selected", func() {
+		selected, other := &corev1.Namespace{}, &corev1.Namespace{}
+		selected.Name = "injectable-selected"
+		other.Name = "injectable-other"
+		var configMaps []*corev1.ConfigMap
+		for _, ns := range []*corev1.Namespace{selected, other} {
+			Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+			cm := &corev1.ConfigMap{}
+			cm.Namespace = ns.Name
+			cm.Name = "ca-bundle"
+			cm.Labels = map[string]string{
+				authority.WantInjectFromSecretNamespaceLabel: caSecretRef.Namespace,
+				authority.WantInjectFromSecretNameLabel:      caSecretRef.Name,
+			}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			configMaps = append(configMaps, cm)
+		}
+
+		By("labelling a namespace after the manager started")
+		selected.Labels = map[string]string{injectLabel: "true"}
+		Expect(k8sClient.Update(ctx, selected)).To(Succeed())
+
+		Eventually(komega.Object(configMaps[0])).Should(
+			HaveField("Data", HaveKeyWithValue(authority.TLSCABundleKey, Not(BeEmpty()))),
+		)
+		Consistently(komega.Object(configMaps[1])).WithTimeout(2 * time.Second).Should(
+			HaveField("Data", BeEmpty()),
+		)
+	})
+
 	It("should set serving certificate", func() {
 		Eventually(func() (*tls.Certificate, error) {
 			return tlsConfig.GetCertificate(nil)
 		}).ShouldNot(BeNil())
 	})
+
+	It("should require client certificates signed by the CA bundle", func() {
+		Eventually(func() (*tls.Config, error) {
+			return tlsConfig.GetConfigForClient(nil)
+		}).Should(And(
+			HaveField("ClientAuth", Equal(tls.RequireAndVerifyClientCert)),
+			HaveField("ClientCAs", Not(BeNil())),
+		))
+
+		By("refusing clients without a client certificate")
+		noClientCertConfig := &tls.Config{ServerName: "webhook.dynamic-authority.svc"}
+		operator.VerifyServerCertificate()(noClientCertConfig)
+		Eventually(func() error {
+			conn, err := tls.Dial("tcp", webhookAddr, noClientCertConfig)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			// The server refuses the handshake after the client completed it
+			_, err = conn.Read(make([]byte, 1))
+			return err
+		}).Should(MatchError(ContainSubstring("certificate required")))
+	})
+
+	It("should authenticate with client certificate signed by the CA", func() {
+		Eventually(func() error {
+			conn, err := tls.Dial("tcp", webhookAddr, clientTLSConfig)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+			return conn.Handshake()
+		}).Should(Succeed())
+	})
 })
+
+// injectLabel labels the namespaces selected for injection of namespaced
+// injectables.
+const injectLabel = "dynamic-authority.example.com/inject"
+
+// widgetInject is an injectable of a kind that is not served by the API server
+// until the CRD returned by newWidgetCRD is installed.
+type widgetInject struct{}
+
+func (i *widgetInject) GroupVersionKind() schema.GroupVersionKind {
+	return schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}
+}
+
+func (i *widgetInject) InjectCA(obj *unstructured.Unstructured, caBundle []byte) (authority.ApplyConfiguration, error) {
+	ac := &unstructured.Unstructured{}
+	ac.SetGroupVersionKind(i.GroupVersionKind())
+	ac.SetName(obj.GetName())
+	if err := unstructured.SetNestedField(ac.Object, string(caBundle), "spec", "caBundle"); err != nil {
+		return nil, err
+	}
+	return unstructuredApplyConfiguration{ac}, nil
+}
+
+// unstructuredApplyConfiguration is an authority.ApplyConfiguration of an
+// unstructured object.
+type unstructuredApplyConfiguration struct {
+	*unstructured.Unstructured
+}
+
+func (ac unstructuredApplyConfiguration) GetName() *string {
+	return ptr.To(ac.Unstructured.GetName())
+}
+
+// newWidgetCRD returns the CRD of the cluster-scoped kind injected by
+// widgetInject.
+func newWidgetCRD() *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]any{
+		"apiVersion": "apiextensions.k8s.io/v1",
+		"kind":       "CustomResourceDefinition",
+		"metadata": map[string]any{
+			"name": "widgets.example.com",
+		},
+		"spec": map[string]any{
+			"group": "example.com",
+			"names": map[string]any{
+				"kind":     "Widget",
+				"listKind": "WidgetList",
+				"plural":   "widgets",
+				"singular": "widget",
+			},
+			"scope": "Cluster",
+			"versions": []any{
+				map[string]any{
+					"name":    "v1",
+					"served":  true,
+					"storage": true,
+					"schema": map[string]any{
+						"openAPIV3Schema": map[string]any{
+							"type":                                 "object",
+							"x-kubernetes-preserve-unknown-fields": true,
+						},
+					},
+				},
+			},
+		},
+	}}
+}